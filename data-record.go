@@ -89,6 +89,11 @@ func (dr *DataRecord) DecodeValue() (string, float64, error) {
 	vif := dr.VIB.VIF & DIB_DIF_WITHOUT_EXTENSION
 	//vife := dr.VIB.VIFe[0] & DIB_DIF_WITHOUT_EXTENSION
 
+	// Manufacturer specific data (0x0F) or more records follow (0x1F), the data has no defined format
+	if dr.DIB.IsEndOfUserData() {
+		return fmt.Sprintf("% X", dr.Data), rawValue, nil
+	}
+
 	unit, err := dr.DecodeUnit()
 	if err != nil {
 		return "", rawValue, err
@@ -230,3 +235,381 @@ func (dr *DataRecord) DecodeValue() (string, float64, error) {
 
 	return buffer.String(), rawValue, nil
 }
+
+// https://github.com/rscada/libmbus/blob/6edab86078b33f6c870215df2fb605b8fb2fab60/mbus/mbus-protocol.c#L3038
+func parseVariableDataRecords(data []byte, dataSize int) (*VariableData, error) {
+	variableRecord := &VariableData{
+		MoreRecordsFollow: false,
+	}
+
+	i := 0
+	dr := 0
+
+	for {
+		if i > dataSize-1 {
+			break
+		}
+
+		// Skip filler bytes (0x2F)
+		// First 2 encryption verification bytes for example ( if present )
+		// And the filler bytes at the end to create the aes blocksize length
+		if data[i]&0xFF == DIB_DIF_IDLE_FILLER {
+			if DEBUG {
+				if i < 2 {
+					fmt.Printf("Skipping encryption verification byte\n")
+				} else {
+					fmt.Printf("Skipping filler byte\n")
+				}
+			}
+
+			i++
+			continue
+		}
+
+		// read and parse DIB (= DIF + DIFE)
+		record := &DataRecord{}
+
+		if DEBUG {
+			dr++
+			fmt.Printf("DR %d :: ", dr)
+		}
+
+		// DIF
+		record.DIB.DIF = data[i]
+
+		if DEBUG {
+			fmt.Printf("DIB.DIF: 0x%.2X; ", data[i])
+		}
+
+		if record.DIB.DIF == DIB_DIF_MANUFACTURER_SPECIFIC || record.DIB.DIF == DIB_DIF_MORE_RECORDS_FOLLOW {
+			if record.DIB.DIF&0xFF == DIB_DIF_MORE_RECORDS_FOLLOW {
+				variableRecord.MoreRecordsFollow = true
+			}
+
+			i++
+
+			// The remaining bytes belong to this record
+			record.DataSize = dataSize - i
+			record.Data = make([]byte, record.DataSize)
+			copy(record.Data, data[i:dataSize])
+
+			i = dataSize
+
+			variableRecord.DataRecords = append(variableRecord.DataRecords, record)
+			continue
+		}
+
+		record.DataSize = DataLengthLookup(record.DIB.DIF)
+
+		if DEBUG {
+			fmt.Printf("Data length lookup: %d; ", record.DataSize)
+		}
+
+		record.DIB.NDIFe = 0
+		record.DIB.DIFe = make([]byte, 10)
+
+		for {
+			if data[i]&DIB_DIF_EXTENSION_BIT == 0 {
+				break
+			}
+
+			if i+1 >= dataSize {
+				return nil, fmt.Errorf("premature end of record at DIFE")
+			}
+
+			if record.DIB.NDIFe >= len(record.DIB.DIFe) {
+				return nil, fmt.Errorf("too many DIFE")
+			}
+
+			dife := data[i+1]
+			record.DIB.DIFe[record.DIB.NDIFe] = dife
+
+			record.DIB.NDIFe++
+			i++
+		}
+		i++
+
+		if i >= dataSize {
+			return nil, fmt.Errorf("premature end of record at DIF")
+		}
+
+		// read and parse VIB (= VIF + VIFE)
+
+		// VIF
+		record.VIB.VIF = data[i]
+
+		if DEBUG {
+			fmt.Printf("VIB.VIF: 0x%.2X; ", record.VIB.VIF)
+		}
+
+		if record.VIB.VIF&DIB_VIF_WITHOUT_EXTENSION == 0x7C {
+			if i+1 >= dataSize {
+				return nil, fmt.Errorf("premature end of record at variable length VIF")
+			}
+
+			i++
+			variableVIFLength := int(data[i])
+			if variableVIFLength > len(record.VIB.Custom) {
+				return nil, fmt.Errorf("too long variable length VIF")
+			}
+
+			if i+variableVIFLength >= dataSize {
+				return nil, fmt.Errorf("premature end of record at variable length VIF")
+			}
+
+			if err := DecodeString(&data[i], &variableVIFLength, &record.VIB.Custom); err != nil {
+				return nil, err
+			}
+
+			i += variableVIFLength
+		}
+
+		// VIFE
+		record.VIB.NVIFe = 0
+
+		if record.VIB.VIF&DIB_VIF_EXTENSION_BIT != 0 {
+			record.VIB.VIFe = make([]byte, 10)
+			record.VIB.VIFe[0] = data[i]
+			record.VIB.NVIFe++
+
+			for {
+				if data[i]&DIB_DIF_EXTENSION_BIT == 0 {
+					break
+				}
+
+				if i+1 >= dataSize {
+					return nil, fmt.Errorf("premature end of record at VIFE")
+				}
+
+				if record.VIB.NVIFe >= len(record.VIB.VIFe) {
+					return nil, fmt.Errorf("too many VIFE")
+				}
+
+				vife := data[i+1]
+				record.VIB.VIFe[record.VIB.NVIFe] = vife
+
+				record.VIB.NVIFe++
+				i++
+			}
+			// This should not be here
+			// https://github.com/rscada/libmbus/blob/6edab86078b33f6c870215df2fb605b8fb2fab60/mbus/mbus-protocol.c#L3202
+			//i++
+		}
+
+		if DEBUG {
+			if record.VIB.NVIFe > 0 {
+				fmt.Printf("VIFe:")
+				for i := 0; i < record.VIB.NVIFe-1; i++ {
+					fmt.Printf(" 0x%.2X", record.VIB.VIFe[i])
+				}
+				fmt.Printf("; ")
+			} else {
+				fmt.Printf("No VIF extension; ")
+			}
+		}
+
+		if i >= dataSize {
+			return nil, fmt.Errorf("premature end of record at VIF.")
+		}
+
+		// re-calculate data length, if of variable length type
+		// 0x0D => Flag for variable data length
+		if record.DIB.DIF&DATA_RECORD_DIF_MASK_DATA == 0x0D {
+			if i+1 >= dataSize {
+				return nil, fmt.Errorf("premature end of record at variable data length")
+			}
+
+			if data[i] <= 0xBF {
+				i++
+				record.DataSize = int(data[i])
+			} else if data[i] >= 0xC0 && data[i] <= 0xCF {
+				i++
+				record.DataSize = (int(data[i]) - 0xC0) * 2
+			} else if data[i] >= 0xD0 && data[i] <= 0xDF {
+				i++
+				record.DataSize = (int(data[i]) - 0xD0) * 2
+			} else if data[i] >= 0xE0 && data[i] <= 0xEF {
+				i++
+				record.DataSize = int(data[i]) - 0xE0
+			} else if data[i] >= 0xF0 && data[i] <= 0xFA {
+				i++
+				record.DataSize = int(data[i]) - 0xF0
+			}
+		}
+
+		if DEBUG {
+			fmt.Printf("Record datasize: %d; ", record.DataSize)
+		}
+
+		if i+record.DataSize >= dataSize {
+			return nil, fmt.Errorf("premature end of record at data.")
+		}
+
+		// Reserve the Record DataSize for the Data byte slice
+		record.Data = make([]byte, record.DataSize)
+
+		if DEBUG {
+			fmt.Printf("Record data:")
+		}
+
+		// Copy the data over
+		for j := 0; j < record.DataSize; j++ {
+			i++
+			record.Data[j] = data[i]
+
+			if DEBUG {
+				fmt.Printf(" 0x%.2X", record.Data[j])
+			}
+		}
+
+		if DEBUG {
+			fmt.Println()
+		}
+
+		variableRecord.DataRecords = append(variableRecord.DataRecords, record)
+
+		i++
+	}
+
+	return variableRecord, nil
+}
+
+// Create a data record to send to a slave. The extension bits of the DIF, DIFEs, VIF and VIFEs are set by Encode.
+// Like the parsed records, the VIF is stored as the first VIFE when there are VIFEs.
+func NewDataRecord(dif byte, difes []byte, vif byte, vifes []byte, data []byte) *DataRecord {
+	record := &DataRecord{
+		Data:     data,
+		DataSize: len(data),
+	}
+
+	record.DIB.DIF = dif
+	record.DIB.DIFe = difes
+	record.DIB.NDIFe = len(difes)
+
+	record.VIB.VIF = vif
+	if len(vifes) > 0 {
+		record.VIB.VIF |= DIB_VIF_EXTENSION_BIT
+		record.VIB.VIFe = append([]byte{record.VIB.VIF}, vifes...)
+		record.VIB.NVIFe = len(record.VIB.VIFe)
+	}
+
+	return record
+}
+
+// Encode the data record into its DIB, VIB and data bytes, the reverse of parseVariableDataRecords
+func (dr *DataRecord) Encode() ([]byte, error) {
+	if dr.DIB.NDIFe > len(dr.DIB.DIFe) || dr.VIB.NVIFe > len(dr.VIB.VIFe) || dr.DataSize > len(dr.Data) {
+		return nil, fmt.Errorf("inconsistent data record")
+	}
+
+	// DIB
+	dif := dr.DIB.DIF &^ DIB_DIF_EXTENSION_BIT
+	if dr.DIB.NDIFe > 0 {
+		dif |= DIB_DIF_EXTENSION_BIT
+	}
+	pack := []byte{dif}
+
+	for i := 0; i < dr.DIB.NDIFe; i++ {
+		dife := dr.DIB.DIFe[i] &^ DATA_RECORD_DIFE_MASK_EXTENSION
+		if i < dr.DIB.NDIFe-1 {
+			dife |= DATA_RECORD_DIFE_MASK_EXTENSION
+		}
+		pack = append(pack, dife)
+	}
+
+	if dr.DIB.IsEndOfUserData() {
+		return append(pack, dr.Data[:dr.DataSize]...), nil
+	}
+
+	// VIB, the first VIFE holds the VIF itself
+	if dr.VIB.VIF&DIB_VIF_WITHOUT_EXTENSION == 0x7C {
+		return nil, fmt.Errorf("plain text VIF is not supported")
+	}
+
+	vif := dr.VIB.VIF &^ DIB_VIF_EXTENSION_BIT
+	if dr.VIB.NVIFe > 1 {
+		vif |= DIB_VIF_EXTENSION_BIT
+	}
+	pack = append(pack, vif)
+
+	for i := 1; i < dr.VIB.NVIFe; i++ {
+		vife := dr.VIB.VIFe[i] &^ DIB_VIF_EXTENSION_BIT
+		if i < dr.VIB.NVIFe-1 {
+			vife |= DIB_VIF_EXTENSION_BIT
+		}
+		pack = append(pack, vife)
+	}
+
+	// Data, variable length data (0x0D) is preceded by its length
+	if dr.DIB.DIF&DATA_RECORD_DIF_MASK_DATA == 0x0D {
+		if dr.DataSize > 0xBF {
+			return nil, fmt.Errorf("variable length data too long (%d bytes)", dr.DataSize)
+		}
+
+		pack = append(pack, byte(dr.DataSize))
+	} else if length := DataLengthLookup(dr.DIB.DIF); length != dr.DataSize {
+		return nil, fmt.Errorf("DIF 0x%.2X requires %d data bytes, got: %d", dr.DIB.DIF, length, dr.DataSize)
+	}
+
+	return append(pack, dr.Data[:dr.DataSize]...), nil
+}
+
+func encodeDataRecords(records []*DataRecord) ([]byte, error) {
+	var pack []byte
+
+	for i, record := range records {
+		data, err := record.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("data record %d: %s", i, err)
+		}
+
+		pack = append(pack, data...)
+	}
+
+	return pack, nil
+}
+
+func decodeDataRecords(records []*DataRecord) ([]DecodedDataRecord, error) {
+	//decodedDataRecords := make([]DecodedDataRecord, len(records))
+	var decodedDataRecords []DecodedDataRecord
+
+	for _, record := range records {
+		decodedDataRecord := DecodedDataRecord{
+			Function:      record.DecodeRecordFunction(),
+			StorageNumber: record.DecodeStorageNumber(),
+			//Quantity:      "",
+		}
+
+		// Decode the tariff
+		tariff, err := record.DecodeTariff()
+		if err != nil {
+			return nil, err
+		} else {
+			// Decode the device
+			device, _ := record.DecodeDevice()
+			decodedDataRecord.Device = device
+		}
+		decodedDataRecord.Tariff = tariff
+
+		// Decode Unit
+		unit, err := record.DecodeUnit()
+		if err != nil {
+			return nil, err
+		}
+		decodedDataRecord.Unit = unit.Unit
+		decodedDataRecord.Exponent = unit.Exp
+		decodedDataRecord.Type = string(rune(unit.Type))
+
+		value, raw, err := record.DecodeValue()
+		if err != nil {
+			return nil, err
+		}
+		decodedDataRecord.Value = value
+		decodedDataRecord.RawValue = raw
+
+		// Append to the rest
+		decodedDataRecords = append(decodedDataRecords, decodedDataRecord)
+	}
+
+	return decodedDataRecords, nil
+}
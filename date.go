@@ -0,0 +1,77 @@
+package mbus
+
+import (
+	"fmt"
+	"time"
+)
+
+// Encoders for the date and time types of EN 13757-3 Annex A, the counterpart of DateCalculator.
+// Type F holds the hundred years and covers 1900 up to 2299, the types without them (G and I) cover 1981 up to 2080,
+// as DateCalculator reads their years 0 to 80 as 2000 to 2080. A year out of range is returned as an error.
+
+func encodeYear(t time.Time, hundredYears bool) (int, int, error) {
+	first, last := 1981, 2080
+	if hundredYears {
+		first, last = 1900, 2299
+	}
+
+	if t.Year() < first || t.Year() > last {
+		return 0, 0, fmt.Errorf("year %d can not be encoded, must be between %d and %d", t.Year(), first, last)
+	}
+
+	year := t.Year() - 1900
+	return year % 100, year / 100, nil
+}
+
+// Type G (CP16): date
+func EncodeDateG(t time.Time) ([]byte, error) {
+	year, _, err := encodeYear(t, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte{
+		byte(t.Day()) | byte(year&0x07)<<5,
+		byte(t.Month()) | byte(year&0x78)<<1,
+	}, nil
+}
+
+// Type F (CP32): date and time with minute resolution
+func EncodeDateTimeF(t time.Time) ([]byte, error) {
+	year, hundredYear, err := encodeYear(t, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte{
+		byte(t.Minute()),
+		byte(t.Hour()) | byte(hundredYear)<<5,
+		byte(t.Day()) | byte(year&0x07)<<5,
+		byte(t.Month()) | byte(year&0x78)<<1,
+	}, nil
+}
+
+// Type I (CP48): date and time with second resolution, including the day of the week and the week number
+func EncodeDateTimeI(t time.Time) ([]byte, error) {
+	year, _, err := encodeYear(t, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Monday is 1, Sunday is 7
+	weekDay := int(t.Weekday())
+	if weekDay == 0 {
+		weekDay = 7
+	}
+
+	_, week := t.ISOWeek()
+
+	return []byte{
+		byte(t.Second()),
+		byte(t.Minute()),
+		byte(t.Hour()) | byte(weekDay)<<5,
+		byte(t.Day()) | byte(year&0x07)<<5,
+		byte(t.Month()) | byte(year&0x78)<<1,
+		byte(week),
+	}, nil
+}
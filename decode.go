@@ -122,3 +122,21 @@ func DecodeASCII(data []byte, decoded *string) {
     }
 }
 
+
+// Decode the 2 byte manufacturer id (LSB first) into its 3 letter code
+func DecodeManufacturerId(manufacturerData []byte, decoded *string) error {
+    var manufacturerId int
+
+    if err := DecodeInt(manufacturerData, len(manufacturerData), &manufacturerId); err != nil {
+        return err
+    }
+
+    *decoded = fmt.Sprintf(
+        "%c%c%c",
+        rune(((manufacturerId >> 10) & 0x001F) + 64),
+        rune(((manufacturerId >> 5) & 0x001F) + 64),
+        rune((manufacturerId & 0x001F) + 64),
+    )
+
+    return nil
+}
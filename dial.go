@@ -0,0 +1,268 @@
+package mbus
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// Opens the handle for a connection string, registered per URL scheme
+type dialFunc func(ctx context.Context, u *url.URL) (Handle, error)
+
+var dialers = map[string]dialFunc{
+	"serial":  dialSerial,
+	"tcp":     dialTCP,
+	"rfc2217": dialRFC2217,
+	"file":    dialFile,
+}
+
+// Open a handle for the connection string, the scheme selects the transport:
+//   - serial:///dev/ttyUSB0?baud=2400&parity=E&size=8&stop=1&timeout=500ms
+//   - tcp://host:10001?connect_timeout=5s&timeout=500ms&keepalive=30s
+//   - rfc2217://host:7000?baud=2400&parity=E&size=8&stop=1&timeout=500ms
+//   - file://capture.hex?realtime=true
+//
+// The serial parameters default to 2400 baud 8N1, the timeout defaults to the ResponseTimeout of the baud rate
+// rounded up to tenths of a second, the resolution of the serial port.
+func Dial(ctx context.Context, connection string) (Handle, error) {
+	u, err := url.Parse(connection)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection string '%s': %s", connection, err)
+	}
+
+	dial, ok := dialers[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, fmt.Errorf("invalid connection string '%s': unsupported scheme '%s'", connection, u.Scheme)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	handle, err := dial(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", connection, err)
+	}
+
+	return handle, nil
+}
+
+func dialSerial(ctx context.Context, u *url.URL) (Handle, error) {
+	// serial:///dev/ttyUSB0 holds the device in the path, serial://COM3 in the host
+	device := u.Host + u.Path
+	if device == "" {
+		return nil, fmt.Errorf("missing serial device")
+	}
+
+	config, err := parseSerialConfig(u.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	// Opening the port can not be cancelled, a context which is done does not open it
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewSerialClient(device, config)
+}
+
+func dialTCP(ctx context.Context, u *url.URL) (Handle, error) {
+	if u.Host == "" || u.Port() == "" {
+		return nil, fmt.Errorf("missing host:port")
+	}
+
+	var config TCPConfig
+	parameters := &urlParameters{values: u.Query()}
+
+	config.ConnectTimeout = parameters.duration("connect_timeout", 10*time.Second)
+	config.ReadTimeout = parameters.duration("timeout", 0)
+	config.KeepAlive = parameters.duration("keepalive", 0)
+
+	if err := parameters.done(); err != nil {
+		return nil, err
+	}
+
+	client, err := newTCPClient(ctx, u.Host, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func dialRFC2217(ctx context.Context, u *url.URL) (Handle, error) {
+	if u.Host == "" || u.Port() == "" {
+		return nil, fmt.Errorf("missing host:port")
+	}
+
+	config, err := parseSerialConfig(u.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newRFC2217Client(ctx, u.Host, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func dialFile(ctx context.Context, u *url.URL) (Handle, error) {
+	// file://capture.hex holds a relative path in the host, file:///var/capture.hex an absolute path
+	path := u.Host + u.Path
+	if path == "" {
+		return nil, fmt.Errorf("missing capture file")
+	}
+
+	var config ReplayConfig
+	parameters := &urlParameters{values: u.Query()}
+
+	config.RealTime = parameters.boolean("realtime", false)
+
+	if err := parameters.done(); err != nil {
+		return nil, err
+	}
+
+	return NewReplayClient(path, config)
+}
+
+func parseSerialConfig(values url.Values) (SerialConfig, error) {
+	var config SerialConfig
+	parameters := &urlParameters{values: values}
+
+	config.Baud = parameters.integer("baud", 2400)
+	config.Size = byte(parameters.integer("size", 8))
+	config.ReadTimeout = parameters.duration("timeout", serialReadTimeout(ResponseTimeout(config.Baud)))
+
+	switch parity := strings.ToUpper(parameters.str("parity", "N")); parity {
+	case "N", "O", "E", "M", "S":
+		config.Parity = serial.Parity(parity[0])
+		break
+	default:
+		parameters.invalid("parity", parity)
+		break
+	}
+
+	switch stop := parameters.str("stop", "1"); stop {
+	case "1":
+		config.StopBits = serial.Stop1
+		break
+	case "1.5":
+		config.StopBits = serial.Stop1Half
+		break
+	case "2":
+		config.StopBits = serial.Stop2
+		break
+	default:
+		parameters.invalid("stop", stop)
+		break
+	}
+
+	if config.Size < 5 || config.Size > 8 {
+		parameters.invalid("size", strconv.Itoa(int(config.Size)))
+	}
+
+	if config.Baud <= 0 {
+		parameters.invalid("baud", strconv.Itoa(config.Baud))
+	}
+
+	return config, parameters.done()
+}
+
+// Reads the query parameters of a connection string, the first invalid or unknown parameter is kept as error
+type urlParameters struct {
+	values url.Values
+	used   []string
+	err    error
+}
+
+func (parameters *urlParameters) str(name string, fallback string) string {
+	parameters.used = append(parameters.used, name)
+
+	if value := parameters.values.Get(name); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func (parameters *urlParameters) integer(name string, fallback int) int {
+	value := parameters.str(name, "")
+	if value == "" {
+		return fallback
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		parameters.invalid(name, value)
+		return fallback
+	}
+
+	return result
+}
+
+func (parameters *urlParameters) boolean(name string, fallback bool) bool {
+	value := parameters.str(name, "")
+	if value == "" {
+		return fallback
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		parameters.invalid(name, value)
+		return fallback
+	}
+
+	return result
+}
+
+func (parameters *urlParameters) duration(name string, fallback time.Duration) time.Duration {
+	value := parameters.str(name, "")
+	if value == "" {
+		return fallback
+	}
+
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		parameters.invalid(name, value)
+		return fallback
+	}
+
+	return result
+}
+
+func (parameters *urlParameters) invalid(name string, value string) {
+	if parameters.err == nil {
+		parameters.err = fmt.Errorf("invalid value '%s' for parameter '%s'", value, name)
+	}
+}
+
+// Returns the first invalid parameter, or an error for a parameter which is not known
+func (parameters *urlParameters) done() error {
+	if parameters.err != nil {
+		return parameters.err
+	}
+
+	for name := range parameters.values {
+		known := false
+		for _, used := range parameters.used {
+			if name == used {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return fmt.Errorf("unknown parameter '%s'", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package mbus
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseSerialConfig(t *testing.T) {
+	values, _ := url.ParseQuery("baud=300&parity=e&stop=2")
+	config, err := parseSerialConfig(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Baud != 300 || config.Parity != 'E' || config.StopBits != 2 || config.Size != 8 || config.ReadTimeout != 1200*time.Millisecond {
+		t.Fatalf("unexpected serial config: %+v", config)
+	}
+
+	// The default timeout is not truncated by the serial port, ResponseTimeout(2400) is 187.5ms
+	config, err = parseSerialConfig(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.ReadTimeout != 200*time.Millisecond {
+		t.Fatalf("expected a timeout of 200ms, got %s", config.ReadTimeout)
+	}
+
+	for _, invalid := range []string{"baud=fast", "parity=X", "stop=3", "size=9", "timeout=1", "bauds=2400"} {
+		values, _ := url.ParseQuery(invalid)
+		if _, err := parseSerialConfig(values); err == nil {
+			t.Fatalf("expected an error for '%s'", invalid)
+		}
+	}
+}
+
+func TestDial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	handle, err := Dial(context.Background(), "tcp://"+listener.Addr().String()+"?timeout=500ms&keepalive=-1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	client, ok := handle.(*MbusTCPHandle)
+	if !ok || client.config.ReadTimeout != 500*time.Millisecond {
+		t.Fatalf("expected a TCP handle with a read timeout of 500ms, got: %T %+v", handle, client)
+	}
+
+	server := newTestDeviceServer(t, nil)
+	handle, err = Dial(context.Background(), "rfc2217://"+server.listener.Addr().String()+"?baud=9600&parity=E")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	if handle.(*MbusRFC2217Handle).BaudRate() != 9600 {
+		t.Fatalf("expected 9600 baud, got: %d", handle.(*MbusRFC2217Handle).BaudRate())
+	}
+
+	for _, invalid := range []string{"ftp://host:21", "tcp://host", "tcp://host:10001?baud=2400", "serial://", "rfc2217://host:7000?parity=X"} {
+		if _, err := Dial(context.Background(), invalid); err == nil {
+			t.Fatalf("expected an error for '%s'", invalid)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Dial(ctx, "tcp://"+listener.Addr().String()); err != context.Canceled {
+		t.Fatalf("expected the dial to be cancelled, got: %v", err)
+	}
+}
+
+func TestDialSerialCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	u, _ := url.Parse("serial:///dev/does-not-exist")
+	if _, err := dialSerial(ctx, u); err != context.Canceled {
+		t.Fatalf("expected the port not to be opened, got: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package mbus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// Returned when a slave did not answer within the response timeout
+	ErrTimeout = errors.New("timeout while waiting for a response")
+	// Returned when the received bytes do not form a valid frame
+	ErrInvalidFrame = errors.New("invalid frame")
+	// Returned when a slave kept answering with invalid frames, which is
+	// usually caused by multiple slaves answering at the same time
+	ErrCollision = errors.New("collision on the bus")
+	// Returned by the wired transactions when the handle has no read timeout,
+	// a slave which does not answer would block the transaction forever
+	ErrNoResponseTimeout = errors.New("no read timeout set, use the ResponseTimeout of the baud rate")
+	// Returned together with the telegrams read so far, when the slave has more records than the telegram limit
+	ErrTruncated = errors.New("readout truncated")
+	// Returned when the device is gone, e.g. an unplugged USB serial adapter
+	ErrDisconnected = errors.New("device disconnected")
+)
+
+// Returned when not all bytes of an encoded frame could be written to the device
+type ShortWriteError struct {
+	Written  int
+	Expected int
+}
+
+func (err *ShortWriteError) Error() string {
+	return fmt.Sprintf("short write, wrote %d of %d bytes", err.Written, err.Expected)
+}
+
+func (err *ShortWriteError) Unwrap() error {
+	return io.ErrShortWrite
+}
+
+// The kind of a FrameError, used to tell line noise apart from frames which are not supported
+var (
+	// The bytes do not form a frame, e.g. a missing start or stop byte or an invalid length
+	ErrFraming = errors.New("framing error")
+	// The checksum of the frame does not match its content
+	ErrChecksum = errors.New("checksum mismatch")
+	// The frame is intact, but holds a control code or CI-field which is not supported
+	ErrUnsupported = errors.New("unsupported frame")
+)
+
+// Returned when the received bytes do not form a valid frame. Both errors.Is(err, ErrInvalidFrame)
+// and errors.Is(err, Kind) hold for a FrameError.
+type FrameError struct {
+	// The bytes received for the frame
+	Raw []byte
+	// Offset in Raw of the byte at which the frame was rejected
+	Offset int
+	// One of ErrFraming, ErrChecksum or ErrUnsupported
+	Kind error
+	Err  error
+}
+
+func (err *FrameError) Error() string {
+	return fmt.Sprintf("%s at offset %d: %s", ErrInvalidFrame, err.Offset, err.Err)
+}
+
+func (err *FrameError) Is(target error) bool {
+	return target == ErrInvalidFrame || target == err.Kind
+}
+
+func (err *FrameError) Unwrap() error {
+	return err.Err
+}
+
+// General application errors reported by a slave with CI 0x70, see ApplicationError
+var (
+	ErrApplicationUnspecified = errors.New("unspecified application error")
+	ErrUnimplementedCI        = errors.New("unimplemented CI-field")
+	ErrBufferTooLong          = errors.New("buffer too long, truncated")
+	ErrTooManyRecords         = errors.New("too many records")
+	ErrPrematureEnd           = errors.New("premature end of record")
+	ErrTooManyDIFEs           = errors.New("more than 10 DIFEs")
+	ErrTooManyVIFEs           = errors.New("more than 10 VIFEs")
+	ErrApplicationReserved    = errors.New("reserved application error")
+	ErrApplicationBusy        = errors.New("application too busy for handling readout request")
+	ErrTooManyReadouts        = errors.New("too many readouts")
+)
+
+var applicationErrors = map[byte]error{
+	ERROR_DATA_UNSPECIFIED:       ErrApplicationUnspecified,
+	ERROR_DATA_UNIMPLEMENTED_CI:  ErrUnimplementedCI,
+	ERROR_DATA_BUFFER_TOO_LONG:   ErrBufferTooLong,
+	ERROR_DATA_TOO_MANY_RECORDS:  ErrTooManyRecords,
+	ERROR_DATA_PREMATURE_END:     ErrPrematureEnd,
+	ERROR_DATA_TOO_MANY_DIFES:    ErrTooManyDIFEs,
+	ERROR_DATA_TOO_MANY_VIFES:    ErrTooManyVIFEs,
+	ERROR_DATA_RESERVED:          ErrApplicationReserved,
+	ERROR_DATA_APPLICATION_BUSY:  ErrApplicationBusy,
+	ERROR_DATA_TOO_MANY_READOUTS: ErrTooManyReadouts,
+}
+
+// Returned when a slave answers with a report of a general application error (CI 0x70),
+// use errors.Is with one of the application error sentinels to check the reported error
+type ApplicationError struct {
+	Address byte
+	Code    byte
+}
+
+func (err *ApplicationError) Error() string {
+	if sentinel, ok := applicationErrors[err.Code]; ok {
+		return fmt.Sprintf("slave 0x%.2X reported an application error: %s", err.Address, sentinel)
+	}
+
+	return fmt.Sprintf("slave 0x%.2X reported an unknown application error 0x%.2X", err.Address, err.Code)
+}
+
+func (err *ApplicationError) Unwrap() error {
+	return applicationErrors[err.Code]
+}
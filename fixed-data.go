@@ -0,0 +1,250 @@
+package mbus
+
+import (
+	"fmt"
+)
+
+// Length of the fixed data structure response (CI 0x73 / 0x77):
+// Id (4), access number (1), status (1), medium and unit (2) and two counters (4 + 4)
+const DATA_FIXED_LENGTH = 16
+
+// Status bits which are specific for the fixed data structure,
+// the lower bits have the same meaning as the status byte of the variable data structure
+const (
+	DATA_FIXED_STATUS_FORMAT_MASK = 0x80
+	DATA_FIXED_STATUS_FORMAT_BCD  = 0x00
+	DATA_FIXED_STATUS_FORMAT_INT  = 0x80
+	DATA_FIXED_STATUS_DATE_MASK   = 0x40
+	DATA_FIXED_STATUS_DATE_STORED = 0x40
+)
+
+// The counter unit which indicates that the second counter holds the stored value of the first counter
+const DATA_FIXED_UNIT_HISTORIC = 0x3E
+
+// Fixed data structure response as defined in EN 1434-3, all multi byte values are stored LSB first
+type FixedData struct {
+	// BCD
+	Id []byte // 4 bytes
+
+	AccessNumber byte
+	Status       byte
+
+	// Bit 0-5 hold the unit of the counter, bit 6-7 hold 2 bits of the medium
+	Counter1Type byte
+	Counter2Type byte
+
+	Counter1 []byte // 4 bytes
+	Counter2 []byte // 4 bytes
+}
+
+type FixedUnit struct {
+	Exp      float64
+	Unit     string
+	Quantity string
+}
+
+// Based on mbus_data_fixed_unit() from https://github.com/rscada/libmbus
+var FixedUnitTable = map[byte]FixedUnit{
+	0x00: {Exp: 1, Unit: MeasureUnit["TIME"], Quantity: "Time"}, // h,m,s
+	0x01: {Exp: 1, Unit: MeasureUnit["DATE"], Quantity: "Date"}, // D,M,Y
+
+	0x02: {Exp: 1e-3, Unit: MeasureUnit["KWH"], Quantity: "Energy"},
+	0x03: {Exp: 1e-2, Unit: MeasureUnit["KWH"], Quantity: "Energy"},
+	0x04: {Exp: 1e-1, Unit: MeasureUnit["KWH"], Quantity: "Energy"},
+	0x05: {Exp: 1e0, Unit: MeasureUnit["KWH"], Quantity: "Energy"},
+	0x06: {Exp: 1e1, Unit: MeasureUnit["KWH"], Quantity: "Energy"},
+	0x07: {Exp: 1e2, Unit: MeasureUnit["KWH"], Quantity: "Energy"},
+	0x08: {Exp: 1e3, Unit: MeasureUnit["KWH"], Quantity: "Energy"},
+	0x09: {Exp: 1e4, Unit: MeasureUnit["KWH"], Quantity: "Energy"},
+	0x0A: {Exp: 1e5, Unit: MeasureUnit["KWH"], Quantity: "Energy"},
+
+	0x0B: {Exp: 1e3, Unit: MeasureUnit["J"], Quantity: "Energy"},
+	0x0C: {Exp: 1e4, Unit: MeasureUnit["J"], Quantity: "Energy"},
+	0x0D: {Exp: 1e5, Unit: MeasureUnit["J"], Quantity: "Energy"},
+	0x0E: {Exp: 1e6, Unit: MeasureUnit["J"], Quantity: "Energy"},
+	0x0F: {Exp: 1e7, Unit: MeasureUnit["J"], Quantity: "Energy"},
+	0x10: {Exp: 1e8, Unit: MeasureUnit["J"], Quantity: "Energy"},
+	0x11: {Exp: 1e9, Unit: MeasureUnit["J"], Quantity: "Energy"},
+	0x12: {Exp: 1e10, Unit: MeasureUnit["J"], Quantity: "Energy"},
+	0x13: {Exp: 1e11, Unit: MeasureUnit["J"], Quantity: "Energy"},
+
+	0x14: {Exp: 1e0, Unit: MeasureUnit["W"], Quantity: "Power"},
+	0x15: {Exp: 1e1, Unit: MeasureUnit["W"], Quantity: "Power"},
+	0x16: {Exp: 1e2, Unit: MeasureUnit["W"], Quantity: "Power"},
+	0x17: {Exp: 1e3, Unit: MeasureUnit["W"], Quantity: "Power"},
+	0x18: {Exp: 1e4, Unit: MeasureUnit["W"], Quantity: "Power"},
+	0x19: {Exp: 1e5, Unit: MeasureUnit["W"], Quantity: "Power"},
+	0x1A: {Exp: 1e6, Unit: MeasureUnit["W"], Quantity: "Power"},
+	0x1B: {Exp: 1e7, Unit: MeasureUnit["W"], Quantity: "Power"},
+	0x1C: {Exp: 1e8, Unit: MeasureUnit["W"], Quantity: "Power"},
+
+	0x1D: {Exp: 1e3, Unit: MeasureUnit["J_H"], Quantity: "Power"},
+	0x1E: {Exp: 1e4, Unit: MeasureUnit["J_H"], Quantity: "Power"},
+	0x1F: {Exp: 1e5, Unit: MeasureUnit["J_H"], Quantity: "Power"},
+	0x20: {Exp: 1e6, Unit: MeasureUnit["J_H"], Quantity: "Power"},
+	0x21: {Exp: 1e7, Unit: MeasureUnit["J_H"], Quantity: "Power"},
+	0x22: {Exp: 1e8, Unit: MeasureUnit["J_H"], Quantity: "Power"},
+	0x23: {Exp: 1e9, Unit: MeasureUnit["J_H"], Quantity: "Power"},
+	0x24: {Exp: 1e10, Unit: MeasureUnit["J_H"], Quantity: "Power"},
+	0x25: {Exp: 1e11, Unit: MeasureUnit["J_H"], Quantity: "Power"},
+
+	0x26: {Exp: 1e-6, Unit: MeasureUnit["M3"], Quantity: "Volume"},
+	0x27: {Exp: 1e-5, Unit: MeasureUnit["M3"], Quantity: "Volume"},
+	0x28: {Exp: 1e-4, Unit: MeasureUnit["M3"], Quantity: "Volume"},
+	0x29: {Exp: 1e-3, Unit: MeasureUnit["M3"], Quantity: "Volume"},
+	0x2A: {Exp: 1e-2, Unit: MeasureUnit["M3"], Quantity: "Volume"},
+	0x2B: {Exp: 1e-1, Unit: MeasureUnit["M3"], Quantity: "Volume"},
+	0x2C: {Exp: 1e0, Unit: MeasureUnit["M3"], Quantity: "Volume"},
+	0x2D: {Exp: 1e1, Unit: MeasureUnit["M3"], Quantity: "Volume"},
+	0x2E: {Exp: 1e2, Unit: MeasureUnit["M3"], Quantity: "Volume"},
+
+	0x2F: {Exp: 1e-6, Unit: MeasureUnit["M3_H"], Quantity: "Volume flow"},
+	0x30: {Exp: 1e-5, Unit: MeasureUnit["M3_H"], Quantity: "Volume flow"},
+	0x31: {Exp: 1e-4, Unit: MeasureUnit["M3_H"], Quantity: "Volume flow"},
+	0x32: {Exp: 1e-3, Unit: MeasureUnit["M3_H"], Quantity: "Volume flow"},
+	0x33: {Exp: 1e-2, Unit: MeasureUnit["M3_H"], Quantity: "Volume flow"},
+	0x34: {Exp: 1e-1, Unit: MeasureUnit["M3_H"], Quantity: "Volume flow"},
+	0x35: {Exp: 1e0, Unit: MeasureUnit["M3_H"], Quantity: "Volume flow"},
+	0x36: {Exp: 1e1, Unit: MeasureUnit["M3_H"], Quantity: "Volume flow"},
+	0x37: {Exp: 1e2, Unit: MeasureUnit["M3_H"], Quantity: "Volume flow"},
+
+	0x38: {Exp: 1e-3, Unit: MeasureUnit["C"], Quantity: "Temperature"},
+	0x39: {Exp: 1, Unit: MeasureUnit["HCA"], Quantity: "H.C.A"},
+	0x3F: {Exp: 1, Unit: MeasureUnit["NONE"], Quantity: "None"},
+}
+
+// Medium of the fixed data structure, which differs from the device type of the variable data structure.
+// Based on mbus_data_fixed_medium() from https://github.com/rscada/libmbus
+func FixedMediumLookup(medium byte) string {
+	switch medium {
+	case 0x00:
+		return "Other"
+	case 0x01:
+		return "Oil"
+	case 0x02:
+		return "Electricity"
+	case 0x03:
+		return "Gas"
+	case 0x04:
+		return "Heat"
+	case 0x05:
+		return "Steam"
+	case 0x06:
+		return "Hot Water"
+	case 0x07:
+		return "Water"
+	case 0x08:
+		return "H.C.A."
+	case 0x0A:
+		return "Gas Mode 2"
+	case 0x0B:
+		return "Heat Mode 2"
+	case 0x0C:
+		return "Hot Water Mode 2"
+	case 0x0D:
+		return "Water Mode 2"
+	case 0x0E:
+		return "H.C.A. Mode 2"
+	default:
+		return "Reserved"
+	}
+}
+
+// Parse a fixed data structure, when msbFirst is set (CI 0x77) the multi byte values are reversed to LSB first
+func parseFixedData(data []byte, dataSize int, msbFirst bool) (*FixedData, error) {
+	if dataSize < DATA_FIXED_LENGTH || len(data) < DATA_FIXED_LENGTH {
+		return nil, fmt.Errorf("premature end of fixed data structure, expected %d bytes, got: %d", DATA_FIXED_LENGTH, dataSize)
+	}
+
+	field := func(from, to int) []byte {
+		value := make([]byte, to-from)
+		copy(value, data[from:to])
+
+		if msbFirst {
+			for i, j := 0, len(value)-1; i < j; i, j = i+1, j-1 {
+				value[i], value[j] = value[j], value[i]
+			}
+		}
+
+		return value
+	}
+
+	return &FixedData{
+		Id:           field(0, 4),
+		AccessNumber: data[4],
+		Status:       data[5],
+		Counter1Type: data[6],
+		Counter2Type: data[7],
+		Counter1:     field(8, 12),
+		Counter2:     field(12, 16),
+	}, nil
+}
+
+func (fixed *FixedData) Medium() byte {
+	return (fixed.Counter1Type&0xC0)>>6 | (fixed.Counter2Type&0xC0)>>4
+}
+
+// Returns true when the counters hold the values stored at a fixed date instead of the actual values
+func (fixed *FixedData) IsStored() bool {
+	return fixed.Status&DATA_FIXED_STATUS_DATE_MASK == DATA_FIXED_STATUS_DATE_STORED
+}
+
+// Decode both counters into data records
+func (fixed *FixedData) DecodeDataRecords() ([]DecodedDataRecord, error) {
+	storageNumber := 0
+	function := "Instantaneous value"
+	if fixed.IsStored() {
+		storageNumber = 1
+		function = "Stored value"
+	}
+
+	counter1Unit := fixed.Counter1Type & 0x3F
+	counter2Unit := fixed.Counter2Type & 0x3F
+	counter2StorageNumber := storageNumber
+
+	// The second counter holds the historic value of the first counter
+	if counter2Unit == DATA_FIXED_UNIT_HISTORIC {
+		counter2Unit = counter1Unit
+		counter2StorageNumber = 1
+	}
+
+	var decodedDataRecords []DecodedDataRecord
+
+	for i, counter := range [][]byte{fixed.Counter1, fixed.Counter2} {
+		unitCode, storage := counter1Unit, storageNumber
+		if i == 1 {
+			unitCode, storage = counter2Unit, counter2StorageNumber
+		}
+
+		unit, ok := FixedUnitTable[unitCode]
+		if !ok {
+			return nil, fmt.Errorf("unknown fixed data unit 0x%.2X", unitCode)
+		}
+
+		decodedDataRecord := DecodedDataRecord{
+			Function:      function,
+			StorageNumber: storage,
+			Unit:          unit.Unit,
+			Exponent:      unit.Exp,
+			Quantity:      unit.Quantity,
+		}
+
+		var value int
+		if fixed.Status&DATA_FIXED_STATUS_FORMAT_MASK == DATA_FIXED_STATUS_FORMAT_INT {
+			if err := DecodeInt(counter, len(counter), &value); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := DecodeBCD(counter, len(counter), &value); err != nil {
+				return nil, err
+			}
+		}
+
+		decodedDataRecord.Value = fmt.Sprintf("%d", value)
+		decodedDataRecord.RawValue = float64(value)
+
+		decodedDataRecords = append(decodedDataRecords, decodedDataRecord)
+	}
+
+	return decodedDataRecords, nil
+}
@@ -0,0 +1,181 @@
+package mbus
+
+import (
+	"errors"
+	"io"
+)
+
+// Splits the bytes of a reader into frames. The input is read in blocks into a reusable buffer, bytes which can not
+// start a frame are skipped and after an invalid frame the search continues at the next byte, so a frame which
+// follows garbage or a partial frame is not lost.
+//
+// A read of 0 bytes without an error is handled as an expired read timeout, like a readFunc. A frame which is still
+// incomplete when no more data arrives is given up on, and the frames within its bytes are searched for. A wired frame
+// is dropped instead, its data could hold the ACK byte 0xE5, which would be taken for the answer of a slave.
+type Framer struct {
+	// The wireless frames hold the link layer CRCs in format A or B, which are verified and removed
+	LinkLayerCRC bool
+	// The bytes the dongle appends to the wireless frames
+	Profile ReceiveProfile
+
+	reader  io.Reader
+	isStart func(b byte) bool
+	decode  func(data []byte, size int) (Frame, ParseReturn, error)
+	// Drop an incomplete frame when no more data arrives, instead of searching its bytes
+	dropIncomplete bool
+
+	buffer []byte
+	start  int
+	end    int
+
+	// Size of the frame at start as far as it is known, it is parsed again when this many bytes are buffered
+	needed int
+	// No data arrived since the last read, incomplete frames in the buffer will not be completed anymore
+	stale bool
+}
+
+// Framer for wireless frames, which start with 0x68 and hold the length in the second byte
+func NewWirelessFramer(reader io.Reader) *Framer {
+	framer := &Framer{
+		reader: reader,
+		isStart: func(b byte) bool {
+			return b == FRAME_LONG_START
+		},
+		buffer: make([]byte, 2*PACKET_BUFF_SIZE),
+	}
+
+	framer.decode = func(data []byte, size int) (Frame, ParseReturn, error) {
+		return decodeWirelessFrame(data, size, framer.LinkLayerCRC, framer.Profile)
+	}
+
+	return framer
+}
+
+// Framer for wired frames (ACK, short, control and long frames)
+func NewWiredFramer(reader io.Reader) *Framer {
+	return &Framer{
+		reader: reader,
+		isStart: func(b byte) bool {
+			return b == FRAME_ACK_START || b == FRAME_SHORT_START || b == FRAME_LONG_START
+		},
+		decode: func(data []byte, size int) (Frame, ParseReturn, error) {
+			frame := NewWiredMBusFrame()
+
+			result, err := ParseWiredMBusData(frame, &data, size)
+			return frame, result, err
+		},
+		buffer:         make([]byte, 2*PACKET_BUFF_SIZE),
+		dropIncomplete: true,
+	}
+}
+
+// Returns the next frame. A FrameError is returned for each rejected frame, ErrTimeout when no data arrived and
+// io.EOF when the reader is exhausted. The buffered bytes are kept, so ReadFrame can be called again after an error.
+func (framer *Framer) ReadFrame() (Frame, error) {
+	for {
+		frame, err := framer.next()
+		if frame != nil || err != nil {
+			return frame, err
+		}
+
+		// Make room for the next block, the bytes before start are not needed anymore
+		if framer.start == framer.end {
+			framer.start, framer.end = 0, 0
+		} else if framer.start > 0 && framer.end == len(framer.buffer) {
+			framer.end = copy(framer.buffer, framer.buffer[framer.start:framer.end])
+			framer.start = 0
+		}
+
+		nread, err := framer.reader.Read(framer.buffer[framer.end:])
+		if nread > 0 {
+			framer.end += nread
+			framer.stale = false
+			continue
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		// Nothing more arrived, search the bytes of the incomplete frame
+		if framer.dropIncomplete {
+			framer.Reset()
+		} else {
+			framer.stale = true
+
+			if frame, frameErr := framer.next(); frame != nil || frameErr != nil {
+				return frame, frameErr
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrTimeout
+	}
+}
+
+// Discard the buffered bytes
+func (framer *Framer) Reset() {
+	framer.start = 0
+	framer.end = 0
+	framer.needed = 0
+	framer.stale = false
+}
+
+// Returns the first complete frame in the buffer, or nil when more data is needed
+func (framer *Framer) next() (Frame, error) {
+	for framer.start < framer.end {
+		if !framer.isStart(framer.buffer[framer.start]) {
+			framer.start++
+			continue
+		}
+
+		data := framer.buffer[framer.start:framer.end]
+
+		if len(data) < framer.needed {
+			if !framer.stale {
+				return nil, nil
+			}
+
+			framer.skip()
+			continue
+		}
+
+		// The size of a frame is known after a few parse rounds, e.g. a long frame needs its length field first
+		size := framer.needed
+		if size == 0 {
+			size = 1
+		}
+
+		for {
+			frame, result, err := framer.decode(data, size)
+			if err != nil {
+				framer.skip()
+				return nil, err
+			}
+
+			if result.Remaining == 0 {
+				framer.start += size
+				framer.needed = 0
+				return frame, nil
+			}
+
+			size += result.Remaining
+
+			if size > len(data) {
+				framer.needed = size
+				break
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// Continue the search for a frame at the byte after the current frame start
+func (framer *Framer) skip() {
+	framer.start++
+	framer.needed = 0
+}
@@ -0,0 +1,161 @@
+package mbus
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Reader which returns the chunks in order, a nil chunk is an expired read timeout
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (reader *chunkReader) Read(buffer []byte) (int, error) {
+	if len(reader.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	chunk := reader.chunks[0]
+	n := copy(buffer, chunk)
+
+	if n < len(chunk) {
+		reader.chunks[0] = chunk[n:]
+	} else {
+		reader.chunks = reader.chunks[1:]
+	}
+
+	return n, nil
+}
+
+// Split the data into chunks of the given size
+func chunked(data []byte, size int) [][]byte {
+	var chunks [][]byte
+	for len(data) > size {
+		chunks = append(chunks, data[:size])
+		data = data[size:]
+	}
+
+	if len(data) > 0 {
+		chunks = append(chunks, data)
+	}
+
+	return chunks
+}
+
+func readFrames(framer *Framer) ([]Frame, []error) {
+	var frames []Frame
+	var errs []error
+
+	for {
+		frame, err := framer.ReadFrame()
+		if err == io.EOF {
+			return frames, errs
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		frames = append(frames, frame)
+	}
+}
+
+func TestWirelessFramer(t *testing.T) {
+	var data []byte
+	data = append(data, 0x00, 0xFF, 0x68, 0x05, 0x44, 0x01, 0x02, 0x03, 0x04, 0x05) // Garbage with a frame start
+	data = append(data, testFrame[:40]...)                                          // Partial frame
+	data = append(data, testFrame...)
+	data = append(data, 0x16, 0x68)
+	data = append(data, testFrame...)
+
+	framer := NewWirelessFramer(&chunkReader{chunks: chunked(data, 7)})
+	frames, errs := readFrames(framer)
+
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got: %d (%v)", len(frames), errs)
+	}
+
+	for _, frame := range frames {
+		if raw := frame.(*WMBusFrame).Raw; !bytes.Equal(raw, testFrame) {
+			t.Fatalf("unexpected raw frame: % X", raw)
+		}
+	}
+
+	for _, err := range errs {
+		if !errors.Is(err, ErrInvalidFrame) {
+			t.Fatalf("expected only invalid frame errors, got: %v", err)
+		}
+	}
+}
+
+func TestWirelessFramerTimeout(t *testing.T) {
+	// The partial frame is given up on when nothing arrives, the next frame is received right away
+	framer := NewWirelessFramer(&chunkReader{chunks: [][]byte{testFrame[:40], nil, testFrame, nil}})
+
+	if _, err := framer.ReadFrame(); err != ErrTimeout {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+
+	frame, err := framer.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if raw := frame.(*WMBusFrame).Raw; !bytes.Equal(raw, testFrame) {
+		t.Fatalf("unexpected raw frame: % X", raw)
+	}
+
+	if _, err := framer.ReadFrame(); err != ErrTimeout {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+
+	if _, err := framer.ReadFrame(); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+}
+
+func TestWiredFramer(t *testing.T) {
+	var data []byte
+	data = append(data, 0x42, FRAME_ACK_START)
+	data = append(data, 0x10, 0x5B, 0x05, 0x00, 0x16) // Short frame with an invalid checksum
+	data = append(data, testWiredFrame...)
+
+	framer := NewWiredFramer(&chunkReader{chunks: chunked(data, 1)})
+	frames, errs := readFrames(framer)
+
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got: %d (%v)", len(frames), errs)
+	}
+
+	if frames[0].(*MBusFrame).Type != FRAME_TYPE_ACK || frames[1].(*MBusFrame).Type != FRAME_TYPE_LONG {
+		t.Fatalf("expected an ack and a long frame, got types: %d %d", frames[0].(*MBusFrame).Type, frames[1].(*MBusFrame).Type)
+	}
+
+	if len(errs) == 0 || !errors.Is(errs[0], ErrChecksum) {
+		t.Fatalf("expected a checksum error, got: %v", errs)
+	}
+}
+
+func TestWirelessFramerAllocations(t *testing.T) {
+	allocs := func(garbage int) float64 {
+		chunks := append(chunked(make([]byte, garbage), 16), testFrame)
+		reader := &chunkReader{}
+		framer := NewWirelessFramer(reader)
+
+		return testing.AllocsPerRun(10, func() {
+			reader.chunks = append(reader.chunks[:0], chunks...)
+
+			if _, err := framer.ReadFrame(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	// The allocations are made for the frame, skipping bytes does not allocate
+	if clean, noisy := allocs(0), allocs(1024); noisy > clean {
+		t.Fatalf("expected no allocations for the skipped bytes, got: %.0f with and %.0f without", noisy, clean)
+	}
+}
@@ -0,0 +1,506 @@
+package mbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// Host controller interface (HCI) of the IMST iM871A and iU891A wM-Bus sticks. Each message is framed as:
+//
+//	SOF | control << 4 | endpoint | message ID | length | payload | [timestamp] | [RSSI] | [CRC]
+//
+// The control bits tell which of the optional fields follow the payload. The CRC covers all bytes after the SOF.
+const (
+	IMST_SOF = 0xA5
+
+	IMST_CONTROL_TIMESTAMP = 0x02
+	IMST_CONTROL_RSSI      = 0x04
+	IMST_CONTROL_CRC       = 0x08
+
+	IMST_ENDPOINT_DEVMGMT   = 0x01
+	IMST_ENDPOINT_RADIOLINK = 0x02
+
+	IMST_DEVMGMT_PING_REQ       = 0x01
+	IMST_DEVMGMT_PING_RSP       = 0x02
+	IMST_DEVMGMT_SET_CONFIG_REQ = 0x03
+	IMST_DEVMGMT_SET_CONFIG_RSP = 0x04
+
+	IMST_RADIOLINK_DATA_IND = 0x03
+
+	// Parameters present in a SET_CONFIG request
+	IMST_CONFIG_DEVICE_MODE = 0x01
+	IMST_CONFIG_LINK_MODE   = 0x02
+
+	IMST_STATUS_OK = 0x00
+
+	// Size of the SOF, control/endpoint, message ID and length field
+	IMST_HEADER_SIZE = 4
+)
+
+// Number of other messages after which a request is considered not to be answered
+const imstMaxSkipped = 32
+
+// wM-Bus link modes of the stick
+const (
+	IMST_LINK_MODE_S1  = 0x00
+	IMST_LINK_MODE_S1M = 0x01
+	IMST_LINK_MODE_S2  = 0x02
+	IMST_LINK_MODE_T1  = 0x03
+	IMST_LINK_MODE_T2  = 0x04
+	IMST_LINK_MODE_R2  = 0x05
+	IMST_LINK_MODE_C1A = 0x06
+	IMST_LINK_MODE_C1B = 0x07
+	IMST_LINK_MODE_C2A = 0x08
+	IMST_LINK_MODE_C2B = 0x09
+)
+
+// The stick acts as a collector (other) or as a meter
+const (
+	IMST_DEVICE_MODE_OTHER = 0x00
+	IMST_DEVICE_MODE_METER = 0x01
+)
+
+var ImstLinkModeLookup = map[string]byte{
+	"S1":  IMST_LINK_MODE_S1,
+	"S1M": IMST_LINK_MODE_S1M,
+	"S2":  IMST_LINK_MODE_S2,
+	"T1":  IMST_LINK_MODE_T1,
+	"T2":  IMST_LINK_MODE_T2,
+	"R2":  IMST_LINK_MODE_R2,
+	"C1A": IMST_LINK_MODE_C1A,
+	"C1B": IMST_LINK_MODE_C1B,
+	"C2A": IMST_LINK_MODE_C2A,
+	"C2B": IMST_LINK_MODE_C2B,
+}
+
+// A single HCI message
+type ImstMessage struct {
+	Endpoint  byte
+	MessageID byte
+	Payload   []byte
+
+	HasTimestamp bool
+	// Time of the stick when the message was received
+	Timestamp uint32
+	HasRSSI   bool
+	// RSSI byte of the transceiver, see ImstRSSI
+	RSSI byte
+}
+
+type ImstConfig struct {
+	// Settings of the serial port, the baud rate defaults to 57600
+	Serial SerialConfig
+
+	// Radio mode which is configured when the handle is opened
+	LinkMode   byte
+	DeviceMode byte
+	// Keep the radio mode in the non-volatile memory of the stick
+	Save bool
+}
+
+type MbusImstHandle struct {
+	MbusHandle
+	Fd io.ReadWriteCloser
+
+	config ImstConfig
+
+	// Received data which has not been read yet and the buffer for reading the port
+	pending []byte
+	buffer  []byte
+	reader  *serialReader
+	// Frames received while waiting for a response
+	frames []Frame
+}
+
+func NewImstClient(device string, config ImstConfig) (Handle, error) {
+	client := &MbusImstHandle{
+		Fd: nil,
+	}
+
+	if err := client.Open(device, config); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (handle *MbusImstHandle) Open(device string, config interface{}) error {
+	imstConfig, ok := config.(ImstConfig)
+	if !ok {
+		return fmt.Errorf("expected an ImstConfig, got: %T", config)
+	}
+
+	serialConfig := imstConfig.Serial
+	if serialConfig.Baud == 0 {
+		serialConfig.Baud = 57600
+	}
+
+	if serialConfig.ReadTimeout == 0 {
+		serialConfig.ReadTimeout = 100 * time.Millisecond
+	}
+
+	port, err := serial.OpenPort(&serial.Config{
+		Name:        device,
+		Baud:        serialConfig.Baud,
+		Size:        serialConfig.Size,
+		StopBits:    serialConfig.StopBits,
+		Parity:      serialConfig.Parity,
+		ReadTimeout: serialConfig.ReadTimeout,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := handle.open(port, imstConfig); err != nil {
+		port.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Use the opened port and configure the radio mode of the stick
+func (handle *MbusImstHandle) open(port io.ReadWriteCloser, config ImstConfig) error {
+	handle.Fd = port
+	handle.reader = &serialReader{port: port}
+	handle.config = config
+	handle.pending = nil
+	handle.buffer = make([]byte, PACKET_BUFF_SIZE)
+	handle.frames = nil
+
+	return handle.SetRadioMode(config.LinkMode, config.DeviceMode, config.Save)
+}
+
+func (handle *MbusImstHandle) Stream(ctx context.Context) chan Frame {
+	stream, _ := handle.StreamWithErrors(ctx)
+	return stream
+}
+
+func (handle *MbusImstHandle) StreamWithErrors(ctx context.Context) (chan Frame, chan error) {
+	return streamFrames(ctx, handle.ReceiveFrame)
+}
+
+func (handle *MbusImstHandle) Close() error {
+	if err := handle.Fd.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (handle *MbusImstHandle) Send(frame Frame) error {
+	return fmt.Errorf("unable to send frames with the IMST stick")
+}
+
+// Receive the next wireless frame, the other messages of the stick are skipped
+func (handle *MbusImstHandle) ReceiveFrame() (Frame, error) {
+	if len(handle.frames) > 0 {
+		frame := handle.frames[0]
+		handle.frames = handle.frames[1:]
+		return frame, nil
+	}
+
+	for {
+		message, err := handle.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		if message.Endpoint == IMST_ENDPOINT_RADIOLINK && message.MessageID == IMST_RADIOLINK_DATA_IND {
+			return message.DecodeFrame()
+		}
+
+		if DEBUG {
+			fmt.Printf("Skipping IMST message [endpoint = 0x%.2X, message = 0x%.2X]\n", message.Endpoint, message.MessageID)
+		}
+	}
+}
+
+// Check if the stick responds
+func (handle *MbusImstHandle) Ping() error {
+	_, err := handle.request(IMST_ENDPOINT_DEVMGMT, IMST_DEVMGMT_PING_REQ, nil, IMST_DEVMGMT_PING_RSP)
+	return err
+}
+
+// Configure the wM-Bus link mode and device mode of the stick through the device management endpoint
+func (handle *MbusImstHandle) SetRadioMode(linkMode byte, deviceMode byte, save bool) error {
+	var nvm byte
+	if save {
+		nvm = 0x01
+	}
+
+	payload := []byte{nvm, IMST_CONFIG_DEVICE_MODE | IMST_CONFIG_LINK_MODE, deviceMode, linkMode}
+
+	response, err := handle.request(IMST_ENDPOINT_DEVMGMT, IMST_DEVMGMT_SET_CONFIG_REQ, payload, IMST_DEVMGMT_SET_CONFIG_RSP)
+	if err != nil {
+		return err
+	}
+
+	if len(response.Payload) == 0 || response.Payload[0] != IMST_STATUS_OK {
+		return fmt.Errorf("unable to set radio mode, got status: % X", response.Payload)
+	}
+
+	return nil
+}
+
+// Write a message with a CRC
+func (handle *MbusImstHandle) WriteMessage(message *ImstMessage) error {
+	data, err := message.Encode(true)
+	if err != nil {
+		return err
+	}
+
+	written, err := handle.Fd.Write(data)
+	if err != nil {
+		return err
+	}
+
+	if written != len(data) {
+		return &ShortWriteError{
+			Written:  written,
+			Expected: len(data),
+		}
+	}
+
+	return nil
+}
+
+// Read the next message. Bytes which do not start a valid message are skipped, ErrTimeout is returned when no
+// complete message arrived. A message of which the rest arrives after the read timeout is lost, the search for the
+// next message continues after its SOF.
+func (handle *MbusImstHandle) ReadMessage() (*ImstMessage, error) {
+	for {
+		for len(handle.pending) > 0 && handle.pending[0] != IMST_SOF {
+			handle.pending = handle.pending[1:]
+		}
+
+		message, size, err := parseImstMessage(handle.pending)
+		if err != nil {
+			// Search for the next message after this SOF
+			handle.pending = handle.pending[1:]
+			return nil, err
+		}
+
+		if message != nil {
+			handle.pending = handle.pending[size:]
+			return message, nil
+		}
+
+		// An unplugged stick is reported as ErrDisconnected, see serialReader
+		nread, err := handle.reader.Read(handle.buffer)
+		if nread == 0 && err == nil {
+			// The read timeout expired, an incomplete message is given up on
+			if len(handle.pending) > 0 {
+				handle.pending = handle.pending[1:]
+			}
+			return nil, ErrTimeout
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		handle.pending = append(handle.pending, handle.buffer[:nread]...)
+	}
+}
+
+// Send a request and wait for its response, the frames received in between are kept for ReceiveFrame.
+// The request fails when the response does not arrive within imstMaxSkipped other or invalid messages.
+func (handle *MbusImstHandle) request(endpoint byte, messageID byte, payload []byte, responseID byte) (*ImstMessage, error) {
+	request := &ImstMessage{
+		Endpoint:  endpoint,
+		MessageID: messageID,
+		Payload:   payload,
+	}
+
+	if err := handle.WriteMessage(request); err != nil {
+		return nil, err
+	}
+
+	for skipped := 0; skipped < imstMaxSkipped; skipped++ {
+		message, err := handle.ReadMessage()
+		if err != nil {
+			if errors.Is(err, ErrInvalidFrame) {
+				continue
+			}
+			return nil, fmt.Errorf("no response to message 0x%.2X: %w", messageID, err)
+		}
+
+		if message.Endpoint == endpoint && message.MessageID == responseID {
+			return message, nil
+		}
+
+		if message.Endpoint == IMST_ENDPOINT_RADIOLINK && message.MessageID == IMST_RADIOLINK_DATA_IND {
+			if frame, err := message.DecodeFrame(); err == nil {
+				handle.frames = append(handle.frames, frame)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no response to message 0x%.2X after %d other messages", messageID, imstMaxSkipped)
+}
+
+// Encode the message, the CRC is appended when crc is set
+func (message *ImstMessage) Encode(crc bool) ([]byte, error) {
+	if message.Endpoint > 0x0F {
+		return nil, fmt.Errorf("invalid endpoint 0x%.2X", message.Endpoint)
+	}
+
+	if len(message.Payload) > 0xFF {
+		return nil, fmt.Errorf("payload of %d bytes is too long", len(message.Payload))
+	}
+
+	var control byte
+	if message.HasTimestamp {
+		control |= IMST_CONTROL_TIMESTAMP
+	}
+
+	if message.HasRSSI {
+		control |= IMST_CONTROL_RSSI
+	}
+
+	if crc {
+		control |= IMST_CONTROL_CRC
+	}
+
+	data := []byte{IMST_SOF, control<<4 | message.Endpoint, message.MessageID, byte(len(message.Payload))}
+	data = append(data, message.Payload...)
+
+	if message.HasTimestamp {
+		timestamp := make([]byte, 4)
+		binary.LittleEndian.PutUint32(timestamp, message.Timestamp)
+		data = append(data, timestamp...)
+	}
+
+	if message.HasRSSI {
+		data = append(data, message.RSSI)
+	}
+
+	if crc {
+		checksum := ImstCRC(data[1:])
+		data = append(data, byte(checksum), byte(checksum>>8))
+	}
+
+	return data, nil
+}
+
+// Unwrap the wM-Bus frame of a radio-link message. The stick removed the link layer CRCs and the L-field,
+// the payload starts with the C-field and the L-field is restored from the length of the payload.
+func (message *ImstMessage) DecodeFrame() (*WMBusFrame, error) {
+	if len(message.Payload) < 10 {
+		return nil, newFrameError(&message.Payload, len(message.Payload), 0, ErrFraming,
+			fmt.Errorf("radio-link message of %d bytes is too short", len(message.Payload)))
+	}
+
+	stripped := append([]byte{byte(len(message.Payload))}, message.Payload...)
+
+	normalized, err := normalizeWirelessFrame(stripped)
+	if err != nil {
+		return nil, newFrameError(&stripped, len(stripped), 0, ErrUnsupported, err)
+	}
+
+	frame := NewWirelessMBusFrame()
+	if _, err := ParseWirelessMBusData(frame, &normalized, len(normalized)); err != nil {
+		return nil, err
+	}
+
+	if message.HasRSSI {
+		frame.RSSI = ImstRSSI(message.RSSI)
+	}
+
+	frame.Raw = normalized
+	return frame, nil
+}
+
+// Parse the message at the start of data. Returns a nil message when more data is needed, and the size of the
+// message in data.
+func parseImstMessage(data []byte) (*ImstMessage, int, error) {
+	if len(data) < IMST_HEADER_SIZE {
+		return nil, 0, nil
+	}
+
+	control := data[1] >> 4
+	if control&^(IMST_CONTROL_TIMESTAMP|IMST_CONTROL_RSSI|IMST_CONTROL_CRC) != 0 {
+		return nil, 0, newFrameError(&data, len(data), 1, ErrFraming, fmt.Errorf("invalid control field 0x%.2X", control))
+	}
+
+	size := IMST_HEADER_SIZE + int(data[3])
+	if control&IMST_CONTROL_TIMESTAMP != 0 {
+		size += 4
+	}
+
+	if control&IMST_CONTROL_RSSI != 0 {
+		size++
+	}
+
+	if control&IMST_CONTROL_CRC != 0 {
+		size += 2
+	}
+
+	if len(data) < size {
+		return nil, 0, nil
+	}
+
+	end := size
+	if control&IMST_CONTROL_CRC != 0 {
+		end -= 2
+
+		expected := ImstCRC(data[1:end])
+		received := binary.LittleEndian.Uint16(data[end:size])
+
+		if received != expected {
+			return nil, 0, newFrameError(&data, size, end, ErrChecksum,
+				fmt.Errorf("%w (0x%.4X != 0x%.4X)", ErrChecksum, received, expected))
+		}
+	}
+
+	message := &ImstMessage{
+		Endpoint:  data[1] & 0x0F,
+		MessageID: data[2],
+		Payload:   append([]byte(nil), data[IMST_HEADER_SIZE:IMST_HEADER_SIZE+int(data[3])]...),
+	}
+
+	offset := IMST_HEADER_SIZE + int(data[3])
+	if control&IMST_CONTROL_TIMESTAMP != 0 {
+		message.HasTimestamp = true
+		message.Timestamp = binary.LittleEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+
+	if control&IMST_CONTROL_RSSI != 0 {
+		message.HasRSSI = true
+		message.RSSI = data[offset]
+	}
+
+	return message, size, nil
+}
+
+// CRC-16 of the HCI (CRC-16/X-25): the reflected CCITT polynomial, initial value 0xFFFF and the result inverted
+func ImstCRC(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+
+	for _, b := range data {
+		crc ^= uint16(b)
+
+		for i := 0; i < 8; i++ {
+			if crc&0x0001 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+
+	return ^crc
+}
+
+// The RSSI byte of the stick in the CC1101 encoding, in dBm
+func ImstRSSI(raw byte) int {
+	return cc1101RSSI(raw)
+}
@@ -0,0 +1,255 @@
+package mbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// Simulates the HCI of an IMST stick, the responses and indications are returned by Read in chunks
+type imstStick struct {
+	linkMode   byte
+	deviceMode byte
+	requests   int
+
+	received []byte
+	response []byte
+	chunk    int
+	// Time an empty read takes, like the read timeout of the port. 0 behaves like an unplugged stick.
+	timeout time.Duration
+}
+
+func (stick *imstStick) Write(data []byte) (int, error) {
+	stick.received = append(stick.received, data...)
+
+	for {
+		message, size, err := parseImstMessage(stick.received)
+		if err != nil {
+			return 0, err
+		}
+
+		if message == nil {
+			return len(data), nil
+		}
+		stick.received = stick.received[size:]
+		stick.requests++
+
+		switch message.MessageID {
+		case IMST_DEVMGMT_PING_REQ:
+			stick.respond(&ImstMessage{Endpoint: IMST_ENDPOINT_DEVMGMT, MessageID: IMST_DEVMGMT_PING_RSP})
+			break
+		case IMST_DEVMGMT_SET_CONFIG_REQ:
+			status := byte(IMST_STATUS_OK)
+			if message.Payload[3] > IMST_LINK_MODE_C2B {
+				status = 0x01
+			}
+
+			stick.deviceMode = message.Payload[2]
+			stick.linkMode = message.Payload[3]
+			stick.respond(&ImstMessage{Endpoint: IMST_ENDPOINT_DEVMGMT, MessageID: IMST_DEVMGMT_SET_CONFIG_RSP, Payload: []byte{status}})
+			break
+		}
+	}
+}
+
+// Like the serial port an expired read timeout and a hangup are reported as io.EOF
+func (stick *imstStick) Read(buffer []byte) (int, error) {
+	if len(stick.response) == 0 {
+		time.Sleep(stick.timeout)
+		return 0, io.EOF
+	}
+
+	size := len(stick.response)
+	if stick.chunk > 0 && size > stick.chunk {
+		size = stick.chunk
+	}
+
+	nread := copy(buffer, stick.response[:size])
+	stick.response = stick.response[nread:]
+	return nread, nil
+}
+
+func (stick *imstStick) Close() error {
+	return nil
+}
+
+func (stick *imstStick) respond(message *ImstMessage) {
+	data, _ := message.Encode(true)
+	stick.response = append(stick.response, data...)
+}
+
+// The radio-link message of testFrame, the stick removed the start byte, the L-field, the CRC and the stop byte
+func testImstIndication() *ImstMessage {
+	payload := append([]byte(nil), testFrame[2:len(testFrame)-3]...)
+
+	return &ImstMessage{
+		Endpoint:     IMST_ENDPOINT_RADIOLINK,
+		MessageID:    IMST_RADIOLINK_DATA_IND,
+		Payload:      payload,
+		HasTimestamp: true,
+		Timestamp:    0x01020304,
+		HasRSSI:      true,
+		RSSI:         0xC0,
+	}
+}
+
+func TestImstCRC(t *testing.T) {
+	if crc := ImstCRC([]byte("123456789")); crc != 0x906E {
+		t.Errorf("expected 0x906E, got 0x%.4X", crc)
+	}
+}
+
+func TestImstHandle(t *testing.T) {
+	stick := &imstStick{chunk: 7, timeout: serialHangupTime}
+	handle := &MbusImstHandle{}
+
+	if err := handle.open(stick, ImstConfig{LinkMode: IMST_LINK_MODE_C1A, DeviceMode: IMST_DEVICE_MODE_OTHER}); err != nil {
+		t.Fatalf("open failed: %s", err)
+	}
+
+	if stick.linkMode != IMST_LINK_MODE_C1A {
+		t.Fatalf("expected link mode C1A, got 0x%.2X", stick.linkMode)
+	}
+
+	// An indication which arrives before the response is kept for ReceiveFrame
+	stick.respond(testImstIndication())
+	if err := handle.Ping(); err != nil {
+		t.Fatalf("Ping failed: %s", err)
+	}
+
+	// Garbage, a corrupted indication and an indication without the optional fields
+	corrupted, _ := testImstIndication().Encode(true)
+	corrupted[10] ^= 0xFF
+	stick.response = append(stick.response, 0x00, 0x12, IMST_SOF)
+	stick.response = append(stick.response, corrupted...)
+
+	plain := testImstIndication()
+	plain.HasTimestamp = false
+	plain.HasRSSI = false
+	data, _ := plain.Encode(false)
+	stick.response = append(stick.response, data...)
+
+	var frames []Frame
+	var invalid int
+	for {
+		frame, err := handle.ReceiveFrame()
+		if errors.Is(err, ErrTimeout) {
+			break
+		}
+
+		if errors.Is(err, ErrInvalidFrame) {
+			invalid++
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("ReceiveFrame failed: %s", err)
+		}
+		frames = append(frames, frame)
+	}
+
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %d", len(frames))
+	}
+
+	if invalid == 0 {
+		t.Fatalf("expected an error for the corrupted indication")
+	}
+
+	// The restored frame matches the received one up to the CRC, including its L-field
+	if raw := frames[0].(*WMBusFrame).Raw; len(raw) != len(testFrame) || !bytes.Equal(raw[:len(raw)-3], testFrame[:len(testFrame)-3]) {
+		t.Fatalf("expected % X, got % X", testFrame, raw)
+	}
+
+	for i, frame := range frames {
+		serialNumber, err := frame.DecodeSerialNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if serialNumber != "25653" {
+			t.Errorf("frame %d: expected serial number 25653, got %s", i, serialNumber)
+		}
+	}
+
+	if rssi := frames[0].(*WMBusFrame).RSSI; rssi != ImstRSSI(0xC0) {
+		t.Fatalf("expected RSSI %d, got %d", ImstRSSI(0xC0), rssi)
+	}
+
+	if rssi := frames[1].(*WMBusFrame).RSSI; rssi != 0 {
+		t.Fatalf("expected no RSSI, got %d", rssi)
+	}
+
+	// The stick refuses an unknown link mode
+	if err := handle.SetRadioMode(0x7F, IMST_DEVICE_MODE_OTHER, false); err == nil {
+		t.Fatalf("expected an error for an unknown link mode")
+	}
+
+	// A request is given up on when only indications keep arriving
+	for i := 0; i < imstMaxSkipped; i++ {
+		stick.respond(testImstIndication())
+	}
+
+	if err := handle.Ping(); err == nil {
+		t.Fatalf("expected an error when the response does not arrive")
+	}
+}
+
+func TestImstHangup(t *testing.T) {
+	stick := &imstStick{timeout: serialHangupTime}
+	handle := &MbusImstHandle{}
+
+	if err := handle.open(stick, ImstConfig{LinkMode: IMST_LINK_MODE_T1}); err != nil {
+		t.Fatalf("open failed: %s", err)
+	}
+
+	if _, err := handle.ReceiveFrame(); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got: %v", err)
+	}
+
+	// The unplugged stick returns at once, which ends the stream
+	stick.timeout = 0
+	stream, errs := handle.StreamWithErrors(context.Background())
+
+	for range stream {
+		t.Fatalf("expected no frames")
+	}
+
+	var err error
+	for err = range errs {
+	}
+
+	if !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("expected ErrDisconnected, got: %v", err)
+	}
+}
+
+func TestImstMessageEncode(t *testing.T) {
+	message := testImstIndication()
+
+	data, err := message.Encode(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, size, err := parseImstMessage(append(data, 0xA5, 0x01))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed == nil || size != len(data) {
+		t.Fatalf("expected a message of %d bytes, got %d", len(data), size)
+	}
+
+	if parsed.Timestamp != message.Timestamp || parsed.RSSI != message.RSSI || len(parsed.Payload) != len(message.Payload) {
+		t.Errorf("expected %+v, got %+v", message, parsed)
+	}
+
+	// Incomplete message
+	if parsed, _, err := parseImstMessage(data[:len(data)-1]); parsed != nil || err != nil {
+		t.Errorf("expected more data to be needed, got %v %v", parsed, err)
+	}
+}
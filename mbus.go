@@ -28,8 +28,6 @@ type Frame interface {
 
 	//Verify() error
 
-	//Encode() ([]byte, int)
-
 	//DecodeTariff() (int, error)
 	//DecodeDevice() (int, error)
 	//DecodeUnit() (string, error)
@@ -51,12 +49,36 @@ type Frame interface {
 	IsDecrypted() bool
 }
 
+// Implemented by the frames of this package, kept out of Frame to not break the frames implemented elsewhere
+type frameEncoder interface {
+	// Encode the frame into its raw bytes, the length and checksum fields are calculated
+	Encode() ([]byte, int)
+}
+
+// Encode the frame into its raw bytes, a length of 0 when the frame can not be encoded
+func encodeFrame(frame Frame) ([]byte, int) {
+	encoder, ok := frame.(frameEncoder)
+	if !ok {
+		return nil, 0
+	}
+
+	return encoder.Encode()
+}
+
 type MbusHandle struct {
 	Fd interface{} // Can be either Serial or TCP
 
 	MaxDataRetry   int
 	MaxSearchRetry int
 	IsSerial       bool
+
+	// The received wireless frames hold the link layer CRCs (frame format A or B), which are verified and removed
+	LinkLayerCRC bool
+	// The bytes the dongle appends to the received wireless frames
+	Profile ReceiveProfile
+
+	// The handle used for the wired M-Bus transactions, set by the handle which embeds this MbusHandle
+	wired WiredHandle
 }
 
 type Handle interface {
@@ -72,6 +94,26 @@ type Handle interface {
 	ReceiveFrame() (Frame, error)
 }
 
+// Handle which reports the errors while receiving (e.g. a FrameError or ErrTimeout), see StreamWithErrors
+type ErrorStreamer interface {
+	// Receive frames through a channel, the errors while receiving are sent to the error channel
+	StreamWithErrors(ctx context.Context) (chan Frame, chan error)
+}
+
+// Handle which can act as the master of a wired M-Bus
+type WiredHandle interface {
+	Handle
+
+	// Receive a single wired frame (ACK, short, control or long frame)
+	ReceiveWiredFrame() (*MBusFrame, error)
+}
+
+// Handle of which the local baud rate can be changed, e.g. a serial port
+type BaudRateHandle interface {
+	BaudRate() int
+	SetLocalBaudRate(baud int) error
+}
+
 type Device struct {
 	SerialNumber string
 	AESKey       []byte
@@ -115,9 +157,10 @@ type VariableData struct {
 type MbusDataFrame struct {
 	Type  int
 	Error int
+	Alarm byte
 
 	Variable *VariableData
-	Fixed    byte
+	Fixed    *FixedData
 }
 
 type DecodedDataRecord struct {
@@ -151,6 +194,10 @@ type DecodedFrame struct {
 
 	DataRecords []DecodedDataRecord
 
+	// Received signal strength in dBm and the link quality indicator of a wireless frame, 0 when unknown
+	RSSI int
+	LQI  int
+
 	ParsedAt time.Time
 }
 
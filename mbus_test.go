@@ -1,8 +1,12 @@
 package mbus
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 var testFrame = []byte{
@@ -293,3 +297,356 @@ func TestDecodeFrame(t *testing.T) {
 		t.Logf("DR %d :: %s: %s %s (%d)\n", i+1, r.Function, r.Value, r.Unit, r.StorageNumber)
 	}
 }
+
+// Wired RSP_UD with a variable data structure (CI 0x72)
+var testWiredFrame = []byte{
+	0x68, 0x1F, 0x1F, 0x68, // Start, L, L, Start
+	0x08, // Control = CONTROL_MASK_RSP_UD
+	0x05, // Primary address
+	0x72, // Control Information
+
+	//************************************
+	// Fixed data header
+	//************************************
+	0x78, 0x56, 0x34, 0x12, // Id ( LSB first ) => 12345678
+	0x2D, 0x2C, // Manufacturer ( LSB first ) => KAM
+	0x01,       // Version
+	0x04,       // Medium => Heat: Outlet
+	0x2A,       // Access no.
+	0x00,       // Status
+	0x00, 0x00, // Signature
+
+	//************************************
+	// Data Records
+	//************************************
+	0x04, 0x06, 0xE8, 0x03, 0x00, 0x00, // DR1, 32 bit integer, Energy (kWh)
+	0x0C, 0x13, 0x27, 0x04, 0x85, 0x02, // DR2, 8 digit BCD, Volume (0.001 m3)
+	0x02, 0x5B, 0x2A, 0x00, // DR3, 16 bit integer, Flow temperature (C)
+
+	0x68, // Checksum
+	0x16, // Stop
+}
+
+func TestParseWiredFrame(t *testing.T) {
+	frame := NewWiredMBusFrame()
+
+	result, err := ParseWiredMBusData(frame, &testWiredFrame, len(testWiredFrame))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Remaining != 0 || !result.GotFrame {
+		t.Fatalf("expected a complete frame, got: %+v", result)
+	}
+
+	if frame.Type != FRAME_TYPE_LONG {
+		t.Fatalf("expected a long frame, got type: %d", frame.Type)
+	}
+
+	var parsed Frame = frame
+	if err := parsed.DataParse(); err != nil {
+		t.Fatal(err)
+	}
+
+	decodedFrame, err := parsed.DecodeFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decodedFrame.SerialNumber != "12345678" {
+		t.Fatalf("decoded serial number does not match expected: '12345678', got: %s", decodedFrame.SerialNumber)
+	}
+
+	if decodedFrame.Manufacturer != "KAM" {
+		t.Fatalf("decoded manufacturer does not match expected: 'KAM', got: %s", decodedFrame.Manufacturer)
+	}
+
+	expectedValues := []string{"1000", "2850427", "42.00"}
+	if len(decodedFrame.DataRecords) != len(expectedValues) {
+		t.Fatalf("expected %d data records, got: %d", len(expectedValues), len(decodedFrame.DataRecords))
+	}
+
+	for i, expected := range expectedValues {
+		if decodedFrame.DataRecords[i].Value != expected {
+			t.Fatalf("DR %d :: expected value: '%s', got: %s", i+1, expected, decodedFrame.DataRecords[i].Value)
+		}
+	}
+}
+
+func TestParseWiredFixedFrame(t *testing.T) {
+	// Water meter 12345678, BCD counters 3412 l and 1000 l (historic)
+	fixed := []byte{
+		0x68, 0x13, 0x13, 0x68, 0x08, 0x05, 0x73,
+		0x78, 0x56, 0x34, 0x12, 0x0A, 0x00, 0xE9, 0x7E,
+		0x12, 0x34, 0x00, 0x00, 0x00, 0x10, 0x00, 0x00,
+		0x00, 0x16,
+	}
+	fixed[len(fixed)-2] = byte(0x08 + 0x05 + 0x73)
+	for _, b := range fixed[7 : len(fixed)-2] {
+		fixed[len(fixed)-2] += b
+	}
+
+	frame := NewWiredMBusFrame()
+	if _, err := ParseWiredMBusData(frame, &fixed, len(fixed)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := frame.DataParse(); err != nil {
+		t.Fatal(err)
+	}
+
+	decodedFrame, err := frame.DecodeFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decodedFrame.SerialNumber != "12345678" || decodedFrame.DeviceType != "Water" || decodedFrame.AccessNumber != 0x0A {
+		t.Fatalf("unexpected fixed data header: %+v", decodedFrame)
+	}
+
+	if len(decodedFrame.DataRecords) != 2 {
+		t.Fatalf("expected 2 data records, got: %d", len(decodedFrame.DataRecords))
+	}
+
+	for i, expected := range []string{"3412", "1000"} {
+		record := decodedFrame.DataRecords[i]
+		if record.Value != expected || record.Unit != "m^3" || record.Exponent != 1e-3 || record.StorageNumber != i ||
+			record.Function != "Instantaneous value" {
+			t.Fatalf("unexpected data record %d: %+v", i, record)
+		}
+	}
+
+	// The status marks the counters as stored at a fixed date
+	fixedData, err := parseFixedData(frame.Data, frame.DataSize, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixedData.Status |= DATA_FIXED_STATUS_DATE_STORED
+
+	records, err := fixedData.DecodeDataRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, record := range records {
+		if record.Function != "Stored value" || record.StorageNumber != 1 {
+			t.Fatalf("unexpected stored data record %d: %+v", i, record)
+		}
+	}
+}
+
+func TestParseWiredFramePartial(t *testing.T) {
+	frame := NewWiredMBusFrame()
+
+	result, err := ParseWiredMBusData(frame, &testWiredFrame, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := len(testWiredFrame) - 10; result.Remaining != expected {
+		t.Fatalf("expected %d remaining bytes, got: %d", expected, result.Remaining)
+	}
+}
+
+func TestParseWiredFrameInvalid(t *testing.T) {
+	tests := map[string]struct {
+		data   []byte
+		kind   error
+		offset int
+	}{
+		"checksum": {[]byte{0x10, 0x5B, 0x05, 0x00, 0x16}, ErrChecksum, 3},
+		"stop":     {[]byte{0x10, 0x5B, 0x05, 0x60, 0x00}, ErrFraming, 4},
+		"length":   {[]byte{0x68, 0x03, 0x04, 0x68, 0x53, 0xFE, 0x50, 0xA1, 0x16}, ErrFraming, 1},
+		"start":    {[]byte{0x42}, ErrFraming, 0},
+		"control":  {[]byte{0x10, 0x08, 0x05, 0x0D, 0x16}, ErrUnsupported, 1},
+	}
+
+	for name, test := range tests {
+		frame := NewWiredMBusFrame()
+
+		_, err := ParseWiredMBusData(frame, &test.data, len(test.data))
+		if !errors.Is(err, ErrInvalidFrame) || !errors.Is(err, test.kind) {
+			t.Fatalf("%s: expected an invalid frame error of kind '%v', got: %v", name, test.kind, err)
+		}
+
+		var frameErr *FrameError
+		if !errors.As(err, &frameErr) || frameErr.Offset != test.offset || !bytes.Equal(frameErr.Raw, test.data) {
+			t.Fatalf("%s: unexpected frame error: %+v", name, frameErr)
+		}
+	}
+
+	ack := []byte{FRAME_ACK_START}
+	frame := NewWiredMBusFrame()
+	if _, err := ParseWiredMBusData(frame, &ack, len(ack)); err != nil || frame.Type != FRAME_TYPE_ACK {
+		t.Fatalf("expected a valid ack frame, got type: %d (%v)", frame.Type, err)
+	}
+}
+
+func TestEncodeWiredFrame(t *testing.T) {
+	tests := map[string]struct {
+		frame    *MBusFrame
+		expected []byte
+	}{
+		"SND_NKE": {NewSndNkeFrame(0x05), []byte{0x10, 0x40, 0x05, 0x45, 0x16}},
+		"REQ_UD2": {NewReqUd2Frame(0x05, true), []byte{0x10, 0x7B, 0x05, 0x80, 0x16}},
+		"SND_UD":  {NewSndUdFrame(0xFE, CONTROL_INFO_APPLICATION_RESET, nil, false), []byte{0x68, 0x03, 0x03, 0x68, 0x53, 0xFE, 0x50, 0xA1, 0x16}},
+		"ACK":     {NewAckFrame(), []byte{0xE5}},
+	}
+
+	for name, test := range tests {
+		data, length := test.frame.Encode()
+		if length != len(test.expected) || !bytes.Equal(data, test.expected) {
+			t.Fatalf("%s: expected % X, got: % X", name, test.expected, data[:length])
+		}
+
+		frame := NewWiredMBusFrame()
+		if _, err := ParseWiredMBusData(frame, &data, length); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+	}
+}
+
+func TestEncodeWiredFrameRoundTrip(t *testing.T) {
+	frame := NewWiredMBusFrame()
+
+	if _, err := ParseWiredMBusData(frame, &testWiredFrame, len(testWiredFrame)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, length := frame.Encode()
+	if !bytes.Equal(data[:length], testWiredFrame) {
+		t.Fatalf("expected % X, got: % X", testWiredFrame, data[:length])
+	}
+}
+
+func TestEncodeWirelessFrame(t *testing.T) {
+	frame := NewWirelessMBusFrame()
+
+	if _, err := ParseWirelessMBusData(frame, &testFrame, len(testFrame)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, length := frame.Encode()
+	if length != len(testFrame) {
+		t.Fatalf("expected %d bytes, got: %d", len(testFrame), length)
+	}
+
+	decoded := NewWirelessMBusFrame()
+	if _, err := ParseWirelessMBusData(decoded, &data, length); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decoded.Data, frame.Data) {
+		t.Fatalf("expected data % X, got: % X", frame.Data, decoded.Data)
+	}
+}
+
+func TestEncodeDate(t *testing.T) {
+	date := time.Date(2021, time.March, 14, 15, 9, 26, 0, time.UTC)
+	dc := DateCalculator{}
+
+	g, err := EncodeDateG(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dc.GetDate(int(g[0]), int(g[1])) != "2021-03-14" {
+		t.Fatalf("expected type G date 2021-03-14, got: %s (% X)", dc.GetDate(int(g[0]), int(g[1])), g)
+	}
+
+	f, err := EncodeDateTimeF(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(f, []byte{0x09, 0x2F, 0xAE, 0x23}) {
+		t.Fatalf("unexpected type F date and time: % X", f)
+	}
+
+	if dc.GetDate(int(f[2]), int(f[3])) != "2021-03-14" || dc.GetTime(int(f[0]), int(f[1])) != "1509" {
+		t.Fatalf("unexpected type F date and time: %s %s", dc.GetDate(int(f[2]), int(f[3])), dc.GetTime(int(f[0]), int(f[1])))
+	}
+
+	// Sunday in week 10
+	i, err := EncodeDateTimeI(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(i, []byte{0x1A, 0x09, 0xEF, 0xAE, 0x23, 0x0A}) {
+		t.Fatalf("unexpected type I date and time: % X", i)
+	}
+
+	if dc.GetTimeWithSeconds(int(i[0]), int(i[1]), int(i[2])) != "150926" {
+		t.Fatalf("unexpected type I time: %s", dc.GetTimeWithSeconds(int(i[0]), int(i[1]), int(i[2])))
+	}
+
+	// Years which do not fit the type are not clamped or wrapped
+	for _, year := range []int{1899, 2300} {
+		if _, err := EncodeDateTimeF(time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+			t.Fatalf("expected an error for type F year %d", year)
+		}
+	}
+
+	for _, year := range []int{1980, 2081} {
+		if _, err := EncodeDateG(time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+			t.Fatalf("expected an error for type G year %d", year)
+		}
+	}
+
+	if f, err := EncodeDateTimeF(time.Date(2150, time.May, 1, 12, 0, 0, 0, time.UTC)); err != nil || f[1]>>5 != 2 {
+		t.Fatalf("expected the hundred years 2 for 2150, got: % X %v", f, err)
+	}
+}
+
+func TestParseWiredFrameTruncatedRecords(t *testing.T) {
+	header := []byte{0x78, 0x56, 0x34, 0x12, 0x2D, 0x2C, 0x01, 0x04, 0x2A, 0x00, 0x00, 0x00}
+
+	tests := []struct {
+		name    string
+		records []byte
+	}{
+		{"DIF", []byte{0x04}},
+		{"DIF with extension bit", []byte{0x84}},
+		{"DIFE with extension bit", []byte{0x84, 0x80}},
+		{"VIF with extension bit", []byte{0x04, 0x93}},
+		{"VIFE with extension bit", []byte{0x04, 0x93, 0x80}},
+		{"variable length DIF", []byte{0x0D, 0x13}},
+		{"variable length VIF", []byte{0x04, 0x7C}},
+		{"data", []byte{0x04, 0x13, 0x01, 0x02}},
+	}
+
+	for _, test := range tests {
+		data := append(append([]byte{}, header...), test.records...)
+		// Without spare capacity a read beyond the data panics
+		data = data[:len(data):len(data)]
+
+		frame := &MBusFrame{
+			Type:               FRAME_TYPE_LONG,
+			Control:            CONTROL_MASK_RSP_UD,
+			ControlInformation: CONTROL_INFO_RESP_VARIABLE,
+			Data:               data,
+			DataSize:           len(data),
+		}
+
+		if err := frame.DataParse(); err == nil || !strings.Contains(err.Error(), "premature end of record") {
+			t.Errorf("%s: expected a premature end of record, got: %v", test.name, err)
+		}
+	}
+}
+
+// A Frame implemented outside of this package, which can not be encoded
+type foreignFrame struct {
+	Frame
+}
+
+func TestEncodeFrame(t *testing.T) {
+	if _, length := encodeFrame(foreignFrame{}); length != 0 {
+		t.Fatalf("expected a frame without Encode to have no bytes, got: %d", length)
+	}
+
+	data, length := encodeFrame(NewSndNkeFrame(0x05))
+	if !bytes.Equal(data[:length], []byte{0x10, 0x40, 0x05, 0x45, 0x16}) {
+		t.Fatalf("unexpected encoded frame: % X", data[:length])
+	}
+}
@@ -1,6 +1,9 @@
 package mbus
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 type ParseReturn struct {
 	Remaining int
@@ -15,7 +18,7 @@ func ParseWirelessMBusData(frame *WMBusFrame, data *[]byte, dataSize int) (Parse
 		return ParseReturn{
 			Remaining: -1,
 			GotFrame:  false,
-		}, fmt.Errorf("got no data")
+		}, newFrameError(data, dataSize, 0, ErrFraming, fmt.Errorf("got no data"))
 	}
 
 	if DEBUG {
@@ -45,7 +48,7 @@ func ParseWirelessMBusData(frame *WMBusFrame, data *[]byte, dataSize int) (Parse
 			return ParseReturn{
 				Remaining: -2,
 				GotFrame:  true,
-			}, fmt.Errorf("too much data in frame")
+			}, newFrameError(data, dataSize, FRAME_BASE_SIZE_SHORT, ErrFraming, fmt.Errorf("too much data in frame"))
 		}
 		break
 	case FRAME_SHORT_START:
@@ -86,6 +89,14 @@ func ParseWirelessMBusData(frame *WMBusFrame, data *[]byte, dataSize int) (Parse
 		}, nil
 	}
 
+	// The header up to the CI-field has to be present
+	if dataSize <= 11 {
+		return ParseReturn{
+			Remaining: -2,
+			GotFrame:  false,
+		}, newFrameError(data, dataSize, 1, ErrFraming, fmt.Errorf("frame too short (%d bytes)", dataSize))
+	}
+
 	frame.Header.Manufacturer = []byte{(*data)[3], (*data)[4]}
 	// The next 4 bytes hold the id (serial number) of the device - LSB first
 	frame.Header.Id = []byte{(*data)[5], (*data)[6], (*data)[7], (*data)[8]}
@@ -102,6 +113,13 @@ func ParseWirelessMBusData(frame *WMBusFrame, data *[]byte, dataSize int) (Parse
 	// Short header
 	case 0x61, 0x65, 0x6A, 0x6E, 0x74, 0x7A, 0x7B, 0x7D, 0x7F, 0x8A:
 		// https://github.com/ganehag/pyMeterBus/blob/bc853aa38ac6b10301bdf97f13ac25b36985316f/meterbus/wtelegram_body.py#L323
+		if dataSize <= 15 {
+			return ParseReturn{
+				Remaining: -2,
+				GotFrame:  false,
+			}, newFrameError(data, dataSize, 1, ErrFraming, fmt.Errorf("frame too short for the short header (%d bytes)", dataSize))
+		}
+
 		frame.Header.AccessNumber = (*data)[12]
 		frame.Header.Status = (*data)[13]
 		frame.Header.NEncryptedBlocks = int((*data)[14])
@@ -122,7 +140,7 @@ func ParseWirelessMBusData(frame *WMBusFrame, data *[]byte, dataSize int) (Parse
 		return ParseReturn{
 			Remaining: -1,
 			GotFrame:  false,
-		}, fmt.Errorf("no valid Control Information byte: %.2X", frame.ControlInformation)
+		}, newFrameError(data, dataSize, 11, ErrUnsupported, fmt.Errorf("no valid Control Information byte: %.2X", frame.ControlInformation))
 	}
 
 	//************************************
@@ -131,6 +149,13 @@ func ParseWirelessMBusData(frame *WMBusFrame, data *[]byte, dataSize int) (Parse
 	// Set the data size
 	frame.DataSize = int(frame.Length) - frameOffset
 
+	if frame.DataSize < 0 {
+		return ParseReturn{
+			Remaining: -2,
+			GotFrame:  false,
+		}, newFrameError(data, dataSize, 1, ErrFraming, fmt.Errorf("frame length %d is too short for the header", frame.Length))
+	}
+
 	// According to the data size, we can determine the Frame Type more accurately
 	if frame.DataSize == 0 {
 		frame.Type = FRAME_TYPE_CONTROL
@@ -170,7 +195,7 @@ func ParseWirelessMBusData(frame *WMBusFrame, data *[]byte, dataSize int) (Parse
 		return ParseReturn{
 			Remaining: -3,
 			GotFrame:  false,
-		}, err
+		}, verifyFrameError(data, dataSize, 2, err)
 	}
 
 	// Successfully parsed data
@@ -356,152 +381,183 @@ func ParseWirelessMBusData(frame *WMBusFrame, data *[]byte, dataSize int) (Parse
 //    }
 //}
 
-//func ParseWiredMBusData(frame *WiredMBusFrame, data *[]byte, dataSize int) (int, error) {
-//    var length int
-//
-//    if dataSize <= 0 {
-//        return -1, nil
-//    }
-//
-//    fmt.Printf("Attempting to parse binary data [size = %d]\n", dataSize)
-//
-//    for i := 0; i < dataSize; i++ {
-//        fmt.Printf("%.2X ", (*data)[i] & 0xFF)
-//    }
-//    fmt.Println()
-//
-//    switch (*data)[0] {
-//    case FRAME_ACK_START:
-//        // OK, got a valid ack frame, require no more data
-//        frame.Start1 = (*data)[0]
-//        frame.Type = FRAME_TYPE_ACK
-//
-//        return 0, nil
-//
-//    case FRAME_SHORT_START:
-//        if dataSize < FRAME_BASE_SIZE_SHORT {
-//            // OK, got a valid short packet start, but we need more data
-//            return FRAME_BASE_SIZE_SHORT - dataSize, nil
-//        }
-//
-//        if dataSize != FRAME_BASE_SIZE_SHORT {
-//            return -2, fmt.Errorf("too much data in frame")
-//        }
-//
-//        frame.Start1 = (*data)[0]
-//        frame.Control = (*data)[1]
-//        frame.Address = (*data)[2]
-//        frame.Checksum = (*data)[3]
-//        frame.Stop = (*data)[4]
-//
-//        frame.Type = FRAME_TYPE_SHORT
-//
-//        validate := TelegramShort(*frame)
-//        if err := validate.Verify(); err != nil {
-//            return -3, err
-//        }
-//
-//        // Successfully parsed data
-//        return 0, nil
-//
-//    case FRAME_LONG_START:
-//        if dataSize < 3 {
-//            // OK, got a valid long/control packet start, but we need
-//            // more data to determine the length
-//            return 3 - dataSize, nil
-//        }
-//
-//        frame.Start1 = (*data)[0]
-//        frame.Length1 = (*data)[1]
-//        frame.Length2 = (*data)[2]
-//
-//        if frame.Length1 < 3 || frame.Length1 != frame.Length2 {
-//            // not a valid M-bus frame
-//            return -2, fmt.Errorf("invalid M-Bus frame length")
-//        }
-//
-//        // check length of packet:
-//        length = int(frame.Length1)
-//
-//        if dataSize < FRAME_FIXED_SIZE_LONG + length {
-//            fmt.Printf("OK, but we need more data. %d %d \n", dataSize, length)
-//            // OK, but we need more data
-//            return FRAME_FIXED_SIZE_LONG + length - dataSize, nil
-//        }
-//
-//        if dataSize > FRAME_FIXED_SIZE_LONG + length {
-//            return -2, fmt.Errorf("too much data in frame")
-//        }
-//
-//        frame.Start2 = (*data)[3]
-//        frame.Control = (*data)[4]
-//        frame.Address = (*data)[5]
-//        frame.ControlInformation = (*data)[6]
-//
-//        frame.DataSize = length - 3
-//        for i := 0; i < frame.DataSize; i++ {
-//            frame.Data[i] = (*data)[7 + i]
-//        }
-//
-//        frame.Checksum = (*data)[dataSize - 2]
-//        frame.Stop = (*data)[dataSize - 1]
-//
-//        if frame.DataSize == 0 {
-//            frame.Type = FRAME_TYPE_CONTROL
-//        } else {
-//            frame.Type = FRAME_TYPE_LONG
-//        }
-//
-//        validate := TelegramLong(*frame)
-//        if err := validate.Verify(); err != nil {
-//           return -3, err
-//        }
-//
-//        // Successfully parsed data
-//        return 0, nil
-//
-//    default:
-//        return -4, fmt.Errorf("invalid M-Bus frame start")
-//    }
-//}
+// Based on mbus_parse() from https://github.com/rscada/libmbus
+func ParseWiredMBusData(frame *MBusFrame, data *[]byte, dataSize int) (ParseReturn, error) {
+	if dataSize <= 0 {
+		return ParseReturn{
+			Remaining: -1,
+			GotFrame:  false,
+		}, newFrameError(data, dataSize, 0, ErrFraming, fmt.Errorf("got no data"))
+	}
 
-//
-//func (frame *MBusFrame) Verify() error {
-//    switch frame.Type {
-//    case FRAME_TYPE_ACK:
-//        if frame.Start1 != FRAME_ACK_START {
-//            return fmt.Errorf("no valid ack type")
-//        }
-//
-//    case FRAME_TYPE_SHORT:
-//        if frame.Start1 != FRAME_SHORT_START {
-//            return fmt.Errorf("no frame start")
-//        }
-//
-//        if frame.Control != CONTROL_MASK_SND_NKE &&
-//            frame.Control != CONTROL_MASK_REQ_UD1 &&
-//            frame.Control != (CONTROL_MASK_REQ_UD1 | CONTROL_MASK_FCB) &&
-//            frame.Control != CONTROL_MASK_REQ_UD2 &&
-//            frame.Control != (CONTROL_MASK_REQ_UD2 | CONTROL_MASK_FCB) {
-//            return fmt.Errorf("unknown control code 0x%.2x", frame.Control)
-//        }
-//
-//    case FRAME_TYPE_CONTROL:
-//    case FRAME_TYPE_LONG:
-//        if frame.Start1 != FRAME_CONTROL_START || frame.Start1 != FRAME_LONG_START {
-//            return fmt.Errorf("no frame start")
-//        }
-//
-//        if frame.Control != CONTROL_MASK_SND_UD &&
-//            frame.Control != (CONTROL_MASK_SND_UD | CONTROL_MASK_FCB) &&
-//            frame.Control != CONTROL_MASK_RSP_UD &&
-//            frame.Control != (CONTROL_MASK_RSP_UD | CONTROL_MASK_DFC) &&
-//            frame.Control != (CONTROL_MASK_RSP_UD | CONTROL_MASK_ACD) &&
-//            frame.Control != (CONTROL_MASK_RSP_UD | CONTROL_MASK_DFC | CONTROL_MASK_ACD) {
-//            return fmt.Errorf("unknown control code 0x%.2x", frame.Control)
-//        }
-//
-//        if frame.Length1 != frame.CalculateLength()
-//    }
-//    return nil
-//}
+	if DEBUG {
+		fmt.Printf("Attempting to parse binary data [size = %d]\n", dataSize)
+
+		for i := 0; i < dataSize; i++ {
+			fmt.Printf("%.2X ", (*data)[i]&0xFF)
+		}
+		fmt.Println()
+	}
+
+	switch (*data)[0] {
+	case FRAME_ACK_START:
+		if dataSize > FRAME_BASE_SIZE_ACK {
+			return ParseReturn{
+				Remaining: -2,
+				GotFrame:  true,
+			}, newFrameError(data, dataSize, FRAME_BASE_SIZE_ACK, ErrFraming, fmt.Errorf("too much data in frame"))
+		}
+
+		// OK, got a valid ack frame, require no more data
+		frame.Start1 = (*data)[0]
+		frame.Type = FRAME_TYPE_ACK
+		frame.DataSize = 0
+
+		return ParseReturn{
+			Remaining: 0,
+			GotFrame:  true,
+		}, nil
+
+	case FRAME_SHORT_START:
+		if dataSize < FRAME_BASE_SIZE_SHORT {
+			// OK, got a valid short packet start, but we need more data
+			return ParseReturn{
+				Remaining: FRAME_BASE_SIZE_SHORT - dataSize,
+				GotFrame:  true,
+			}, nil
+		}
+
+		if dataSize > FRAME_BASE_SIZE_SHORT {
+			return ParseReturn{
+				Remaining: -2,
+				GotFrame:  true,
+			}, newFrameError(data, dataSize, FRAME_BASE_SIZE_SHORT, ErrFraming, fmt.Errorf("too much data in frame"))
+		}
+
+		frame.Start1 = (*data)[0]
+		frame.Control = (*data)[1]
+		frame.Address = (*data)[2]
+		frame.Checksum = (*data)[3]
+		frame.Stop = (*data)[4]
+		frame.DataSize = 0
+
+		frame.Type = FRAME_TYPE_SHORT
+
+	// case FRAME_CONTROL_START: A control frame and a Long frame have the same start byte 0x68
+	case FRAME_LONG_START:
+		if dataSize < 3 {
+			// OK, got a valid long/control packet start, but we need
+			// more data to determine the length
+			return ParseReturn{
+				Remaining: 3 - dataSize,
+				GotFrame:  true,
+			}, nil
+		}
+
+		frame.Start1 = (*data)[0]
+		frame.Length1 = (*data)[1]
+		frame.Length2 = (*data)[2]
+
+		if frame.Length1 < 3 || frame.Length1 != frame.Length2 {
+			// not a valid M-bus frame
+			return ParseReturn{
+				Remaining: -2,
+				GotFrame:  false,
+			}, newFrameError(data, dataSize, 1, ErrFraming, fmt.Errorf("invalid M-Bus frame length"))
+		}
+
+		// check length of packet:
+		length := int(frame.Length1)
+
+		if dataSize < FRAME_FIXED_SIZE_LONG+length {
+			// OK, but we need more data
+			return ParseReturn{
+				Remaining: FRAME_FIXED_SIZE_LONG + length - dataSize,
+				GotFrame:  true,
+			}, nil
+		}
+
+		if dataSize > FRAME_FIXED_SIZE_LONG+length {
+			return ParseReturn{
+				Remaining: -2,
+				GotFrame:  true,
+			}, newFrameError(data, dataSize, FRAME_FIXED_SIZE_LONG+length, ErrFraming, fmt.Errorf("too much data in frame"))
+		}
+
+		frame.Start2 = (*data)[3]
+		frame.Control = (*data)[4]
+		frame.Address = (*data)[5]
+		frame.ControlInformation = (*data)[6]
+
+		// Reserve space for the data and copy it over
+		frame.DataSize = length - 3
+		frame.Data = make([]byte, frame.DataSize)
+		copy(frame.Data, (*data)[7:7+frame.DataSize])
+
+		frame.Checksum = (*data)[dataSize-2]
+		// The last byte is the stop byte
+		frame.Stop = (*data)[dataSize-1]
+
+		if frame.DataSize == 0 {
+			frame.Type = FRAME_TYPE_CONTROL
+		} else {
+			frame.Type = FRAME_TYPE_LONG
+		}
+
+	default:
+		return ParseReturn{
+			Remaining: -4,
+			GotFrame:  false,
+		}, newFrameError(data, dataSize, 0, ErrFraming, fmt.Errorf("invalid M-Bus frame start 0x%.2X", (*data)[0]))
+	}
+
+	if err := frame.Verify(); err != nil {
+		// The control code of a short frame is its second byte, of a long frame the fifth
+		controlOffset := 4
+		if frame.Type == FRAME_TYPE_SHORT {
+			controlOffset = 1
+		}
+
+		return ParseReturn{
+			Remaining: -3,
+			GotFrame:  false,
+		}, verifyFrameError(data, dataSize, controlOffset, err)
+	}
+
+	frame.decodeHeader()
+
+	// Successfully parsed data
+	return ParseReturn{
+		Remaining: 0,
+		GotFrame:  true,
+	}, nil
+}
+
+// Wrap a parse error in a FrameError holding a copy of the received bytes
+func newFrameError(data *[]byte, dataSize int, offset int, kind error, err error) *FrameError {
+	var raw []byte
+	if data != nil && dataSize > 0 {
+		raw = append([]byte{}, (*data)[:dataSize]...)
+	}
+
+	return &FrameError{
+		Raw:    raw,
+		Offset: offset,
+		Kind:   kind,
+		Err:    err,
+	}
+}
+
+// Wrap the verification error of a complete frame, the offset points at the checksum, the
+// control code or else at the stop byte
+func verifyFrameError(data *[]byte, dataSize int, controlOffset int, err error) *FrameError {
+	if errors.Is(err, ErrChecksum) {
+		return newFrameError(data, dataSize, dataSize-2, ErrChecksum, err)
+	}
+
+	if errors.Is(err, ErrUnsupported) {
+		return newFrameError(data, dataSize, controlOffset, ErrUnsupported, err)
+	}
+
+	return newFrameError(data, dataSize, dataSize-1, ErrFraming, err)
+}
@@ -1,5 +1,7 @@
 package mbus
 
+import "fmt"
+
 var products = map[string /* Manufacturer */]map[byte /* Version */]string /* Product name */ {
     "LAS": {
         0x01: "LAN-WMBUS-E-VOC",
@@ -10,3 +12,16 @@ var products = map[string /* Manufacturer */]map[byte /* Version */]string /* Pr
         0x1E: "LAN-WMBUS-G2-EXT / LAN-WMBUS-G2-OOP",
     },
 }
+
+func ProductNameLookup(manufacturer string, version byte) (string, error) {
+    _, ok := products[manufacturer]
+    if !ok {
+        return "", fmt.Errorf("could not find manufacturer: %s", manufacturer)
+    }
+
+    if productName, ok := products[manufacturer][version]; ok {
+        return productName, nil
+    }
+
+    return "", fmt.Errorf("could not find product version: 0x%.2X, for manufacturer: %s", version, manufacturer)
+}
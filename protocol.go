@@ -114,6 +114,14 @@ const (
 	// 71h                      report of alarm status          Usergroup March 94
 	// 72h   76h                variable data respond                EN1434-3
 	// 73h   77h                 fixed data respond                  EN1434-3
+	// 6Ch                   time synchronisation (absolute)          EN13757-3
+	// 6Dh                   time synchronisation (relative)          EN13757-3
+	CONTROL_INFO_TIME_SYNC_ABSOLUTE = 0x6C
+	CONTROL_INFO_TIME_SYNC_RELATIVE = 0x6D
+
+	// TC byte in front of the date and time of an absolute time synchronisation, the clock is set to the given time
+	TIME_SYNC_TC_SET = 0x00
+
 	CONTROL_INFO_ERROR_GENERAL = 0x70
 	CONTROL_INFO_STATUS_ALARM  = 0x71
 
@@ -205,6 +213,7 @@ const (
 	DATA_TYPE_FIXED    = 1
 	DATA_TYPE_VARIABLE = 2
 	DATA_TYPE_ERROR    = 3
+	DATA_TYPE_ALARM    = 4
 
 	DIB_DIF_WITHOUT_EXTENSION     = 0x7F
 	DIB_DIF_EXTENSION_BIT         = 0x80
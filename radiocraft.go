@@ -0,0 +1,287 @@
+package mbus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Gives access to the bytes of the connection as is, bypassing the framing, e.g. to configure the dongle
+type RawHandle interface {
+	WriteRaw(data []byte) error
+	// Returns 0 bytes when the read timeout expired
+	ReadRaw(buffer []byte) (int, error)
+}
+
+// Commands of the configuration mode of the Radiocraft RC1180-MBUS3, see its user manual
+const (
+	RADIOCRAFT_CONFIG_ENTER = 0x00
+	RADIOCRAFT_PROMPT       = '>'
+	RADIOCRAFT_CMD_READ     = 'Y'
+	RADIOCRAFT_CMD_MEMORY   = 'M'
+	RADIOCRAFT_CMD_EXIT     = 'X'
+	// Ends the address/value pairs of the memory command
+	RADIOCRAFT_MEMORY_END = 0xFF
+)
+
+// Addresses of the NVM parameters of the Radiocraft RC1180-MBUS3
+const (
+	RADIOCRAFT_NVM_MBUS_MODE      = 0x03
+	RADIOCRAFT_NVM_RSSI_MODE      = 0x05
+	RADIOCRAFT_NVM_DATA_INTERFACE = 0x36
+	RADIOCRAFT_NVM_INSTALL_MODE   = 0x3D
+)
+
+// Values of the MBUS_MODE parameter
+const (
+	RADIOCRAFT_MODE_S1 = 0x03
+	RADIOCRAFT_MODE_T1 = 0x01
+	RADIOCRAFT_MODE_C1 = 0x0E
+)
+
+// Bits of the DATA_INTERFACE parameter, 0x0C adds the start/stop byte and the CRC to the received frames
+const (
+	RADIOCRAFT_INTERFACE_START_STOP = 0x04
+	RADIOCRAFT_INTERFACE_CRC        = 0x08
+)
+
+// Values of the INSTALL_MODE parameter
+const (
+	// Only the frames of the meters in the installation filter are received
+	RADIOCRAFT_INSTALL_FILTER = 0x00
+	// The frames of all meters are received
+	RADIOCRAFT_INSTALL_ALL = 0x01
+)
+
+// Number of read timeouts in a row after which the module is considered not to respond
+const radiocraftMaxTimeouts = 3
+
+var RadiocraftModeLookup = map[string]byte{
+	"S1": RADIOCRAFT_MODE_S1,
+	"T1": RADIOCRAFT_MODE_T1,
+	"C1": RADIOCRAFT_MODE_C1,
+}
+
+// The parameters which bring the module into a known state, see Radiocraft.Configure
+type RadiocraftConfig struct {
+	Mode byte
+	// Append the RSSI to the received frames, use ProfileRadiocraft to decode it
+	RSSI          bool
+	DataInterface byte
+	InstallMode   byte
+}
+
+// Configures a Radiocraft RC1180-MBUS3 module through its configuration mode. No frames should be received from
+// the handle while the module is in configuration mode. The handle needs a read timeout, the context is checked
+// between the reads and a module which does not respond is detected by reads of 0 bytes.
+type Radiocraft struct {
+	handle RawHandle
+	config bool
+}
+
+func NewRadiocraft(handle RawHandle) *Radiocraft {
+	return &Radiocraft{
+		handle: handle,
+	}
+}
+
+// Enter the configuration mode, the bytes of frames received before the prompt are skipped
+func (radio *Radiocraft) EnterConfig(ctx context.Context) error {
+	if err := radio.handle.WriteRaw([]byte{RADIOCRAFT_CONFIG_ENTER}); err != nil {
+		return err
+	}
+
+	if err := radio.waitPrompt(ctx); err != nil {
+		return fmt.Errorf("unable to enter config mode: %w", err)
+	}
+
+	radio.config = true
+	return nil
+}
+
+// Leave the configuration mode, the module does not respond to it
+func (radio *Radiocraft) ExitConfig() error {
+	if err := radio.handle.WriteRaw([]byte{RADIOCRAFT_CMD_EXIT}); err != nil {
+		return err
+	}
+
+	radio.config = false
+	return nil
+}
+
+// Read a single NVM parameter
+func (radio *Radiocraft) ReadParameter(ctx context.Context, address byte) (byte, error) {
+	if !radio.config {
+		return 0, fmt.Errorf("not in config mode")
+	}
+
+	if err := radio.handle.WriteRaw([]byte{RADIOCRAFT_CMD_READ, address}); err != nil {
+		return 0, err
+	}
+
+	value, err := radio.readByte(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read parameter 0x%.2X: %w", address, err)
+	}
+
+	if err := radio.waitPrompt(ctx); err != nil {
+		return 0, fmt.Errorf("unable to read parameter 0x%.2X: %w", address, err)
+	}
+
+	return value, nil
+}
+
+// Write the NVM parameters, given as address => value, in a single memory command
+func (radio *Radiocraft) WriteParameters(ctx context.Context, parameters map[byte]byte) error {
+	if !radio.config {
+		return fmt.Errorf("not in config mode")
+	}
+
+	if len(parameters) == 0 {
+		return nil
+	}
+
+	addresses := make([]int, 0, len(parameters))
+	for address := range parameters {
+		if address == RADIOCRAFT_MEMORY_END {
+			return fmt.Errorf("parameter address 0x%.2X is reserved", address)
+		}
+		addresses = append(addresses, int(address))
+	}
+	sort.Ints(addresses)
+
+	if err := radio.handle.WriteRaw([]byte{RADIOCRAFT_CMD_MEMORY}); err != nil {
+		return err
+	}
+
+	if err := radio.waitPrompt(ctx); err != nil {
+		return fmt.Errorf("unable to start memory configuration: %w", err)
+	}
+
+	data := make([]byte, 0, 2*len(parameters)+1)
+	for _, address := range addresses {
+		data = append(data, byte(address), parameters[byte(address)])
+	}
+	data = append(data, RADIOCRAFT_MEMORY_END)
+
+	if err := radio.handle.WriteRaw(data); err != nil {
+		return err
+	}
+
+	if err := radio.waitPrompt(ctx); err != nil {
+		return fmt.Errorf("unable to write parameters: %w", err)
+	}
+
+	return nil
+}
+
+// Read the parameters of RadiocraftConfig
+func (radio *Radiocraft) ReadConfig(ctx context.Context) (RadiocraftConfig, error) {
+	var config RadiocraftConfig
+	values := make(map[byte]byte)
+
+	for _, address := range []byte{
+		RADIOCRAFT_NVM_MBUS_MODE,
+		RADIOCRAFT_NVM_RSSI_MODE,
+		RADIOCRAFT_NVM_DATA_INTERFACE,
+		RADIOCRAFT_NVM_INSTALL_MODE,
+	} {
+		value, err := radio.ReadParameter(ctx, address)
+		if err != nil {
+			return config, err
+		}
+		values[address] = value
+	}
+
+	config.Mode = values[RADIOCRAFT_NVM_MBUS_MODE]
+	config.RSSI = values[RADIOCRAFT_NVM_RSSI_MODE] != 0
+	config.DataInterface = values[RADIOCRAFT_NVM_DATA_INTERFACE]
+	config.InstallMode = values[RADIOCRAFT_NVM_INSTALL_MODE]
+	return config, nil
+}
+
+// Bring the module into the given state. Only the parameters which differ are written, to spare the NVM.
+func (radio *Radiocraft) Configure(ctx context.Context, config RadiocraftConfig) error {
+	if err := radio.EnterConfig(ctx); err != nil {
+		return err
+	}
+
+	current, err := radio.ReadConfig(ctx)
+	if err != nil {
+		radio.ExitConfig()
+		return err
+	}
+
+	parameters := make(map[byte]byte)
+	if current.Mode != config.Mode {
+		parameters[RADIOCRAFT_NVM_MBUS_MODE] = config.Mode
+	}
+
+	if current.RSSI != config.RSSI {
+		parameters[RADIOCRAFT_NVM_RSSI_MODE] = 0
+		if config.RSSI {
+			parameters[RADIOCRAFT_NVM_RSSI_MODE] = 1
+		}
+	}
+
+	if current.DataInterface != config.DataInterface {
+		parameters[RADIOCRAFT_NVM_DATA_INTERFACE] = config.DataInterface
+	}
+
+	if current.InstallMode != config.InstallMode {
+		parameters[RADIOCRAFT_NVM_INSTALL_MODE] = config.InstallMode
+	}
+
+	if DEBUG {
+		fmt.Printf("Radiocraft parameters to write: %v\n", parameters)
+	}
+
+	if err := radio.WriteParameters(ctx, parameters); err != nil {
+		radio.ExitConfig()
+		return err
+	}
+
+	return radio.ExitConfig()
+}
+
+// Read a single byte, ErrTimeout when the module does not respond. The context is checked before each read,
+// so it is only noticed within the read timeout of the handle.
+func (radio *Radiocraft) readByte(ctx context.Context) (byte, error) {
+	buffer := make([]byte, 1)
+
+	for timeouts := 0; timeouts < radiocraftMaxTimeouts; {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		nread, err := radio.handle.ReadRaw(buffer)
+		if err != nil {
+			return 0, err
+		}
+
+		if nread == 0 {
+			timeouts++
+			continue
+		}
+
+		return buffer[0], nil
+	}
+
+	return 0, ErrTimeout
+}
+
+// Wait for the prompt, the bytes before it are skipped
+func (radio *Radiocraft) waitPrompt(ctx context.Context) error {
+	for skipped := 0; skipped < PACKET_BUFF_SIZE; skipped++ {
+		b, err := radio.readByte(ctx)
+		if err != nil {
+			return err
+		}
+
+		if b == RADIOCRAFT_PROMPT {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("got no prompt after %d bytes", PACKET_BUFF_SIZE)
+}
@@ -0,0 +1,187 @@
+package mbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Simulates the configuration mode of a RC1180-MBUS3, the responses are returned by ReadRaw
+type radiocraftModule struct {
+	nvm      [256]byte
+	config   bool
+	memory   bool
+	pending  []byte
+	response []byte
+	writes   int
+	silent   bool
+}
+
+func (module *radiocraftModule) WriteRaw(data []byte) error {
+	module.pending = append(module.pending, data...)
+
+	for len(module.pending) > 0 {
+		if module.silent {
+			module.pending = nil
+			break
+		}
+
+		if !module.config {
+			if module.pending[0] == RADIOCRAFT_CONFIG_ENTER {
+				module.config = true
+				module.response = append(module.response, RADIOCRAFT_PROMPT)
+			}
+			module.pending = module.pending[1:]
+			continue
+		}
+
+		if module.memory {
+			if module.pending[0] == RADIOCRAFT_MEMORY_END {
+				module.memory = false
+				module.response = append(module.response, RADIOCRAFT_PROMPT)
+				module.pending = module.pending[1:]
+				continue
+			}
+
+			if len(module.pending) < 2 {
+				break
+			}
+
+			module.nvm[module.pending[0]] = module.pending[1]
+			module.writes++
+			module.pending = module.pending[2:]
+			continue
+		}
+
+		switch module.pending[0] {
+		case RADIOCRAFT_CMD_READ:
+			if len(module.pending) < 2 {
+				return nil
+			}
+
+			module.response = append(module.response, module.nvm[module.pending[1]], RADIOCRAFT_PROMPT)
+			module.pending = module.pending[2:]
+			continue
+		case RADIOCRAFT_CMD_MEMORY:
+			module.memory = true
+			module.response = append(module.response, RADIOCRAFT_PROMPT)
+			break
+		case RADIOCRAFT_CMD_EXIT:
+			module.config = false
+			break
+		}
+
+		module.pending = module.pending[1:]
+	}
+
+	return nil
+}
+
+func (module *radiocraftModule) ReadRaw(buffer []byte) (int, error) {
+	nread := copy(buffer, module.response)
+	module.response = module.response[nread:]
+	return nread, nil
+}
+
+func TestRadiocraftConfigure(t *testing.T) {
+	module := &radiocraftModule{}
+	module.nvm[RADIOCRAFT_NVM_MBUS_MODE] = RADIOCRAFT_MODE_S1
+	// A frame which is received before entering the config mode
+	module.response = []byte{0x68, 0x0A, 0x44, 0x2D}
+
+	config := RadiocraftConfig{
+		Mode:          RADIOCRAFT_MODE_T1,
+		RSSI:          true,
+		DataInterface: RADIOCRAFT_INTERFACE_START_STOP | RADIOCRAFT_INTERFACE_CRC,
+		InstallMode:   RADIOCRAFT_INSTALL_ALL,
+	}
+
+	radio := NewRadiocraft(module)
+	if err := radio.Configure(context.Background(), config); err != nil {
+		t.Fatalf("Configure failed: %s", err)
+	}
+
+	if module.config {
+		t.Errorf("module is still in config mode")
+	}
+
+	expected := map[byte]byte{
+		RADIOCRAFT_NVM_MBUS_MODE:      RADIOCRAFT_MODE_T1,
+		RADIOCRAFT_NVM_RSSI_MODE:      1,
+		RADIOCRAFT_NVM_DATA_INTERFACE: 0x0C,
+		RADIOCRAFT_NVM_INSTALL_MODE:   RADIOCRAFT_INSTALL_ALL,
+	}
+	for address, value := range expected {
+		if module.nvm[address] != value {
+			t.Errorf("parameter 0x%.2X: expected 0x%.2X, got 0x%.2X", address, value, module.nvm[address])
+		}
+	}
+
+	// Configuring the same state again writes nothing
+	module.writes = 0
+	if err := radio.Configure(context.Background(), config); err != nil {
+		t.Fatalf("Configure failed: %s", err)
+	}
+
+	if module.writes != 0 {
+		t.Errorf("expected no writes, got %d", module.writes)
+	}
+}
+
+func TestRadiocraftParameters(t *testing.T) {
+	module := &radiocraftModule{}
+	radio := NewRadiocraft(module)
+
+	if _, err := radio.ReadParameter(context.Background(), RADIOCRAFT_NVM_MBUS_MODE); err == nil {
+		t.Errorf("expected an error outside of config mode")
+	}
+
+	if err := radio.EnterConfig(context.Background()); err != nil {
+		t.Fatalf("EnterConfig failed: %s", err)
+	}
+
+	// A value which equals the prompt
+	parameters := map[byte]byte{0x10: RADIOCRAFT_PROMPT, 0x02: 0x00}
+	if err := radio.WriteParameters(context.Background(), parameters); err != nil {
+		t.Fatalf("WriteParameters failed: %s", err)
+	}
+
+	for address, value := range parameters {
+		got, err := radio.ReadParameter(context.Background(), address)
+		if err != nil {
+			t.Fatalf("ReadParameter failed: %s", err)
+		}
+
+		if got != value {
+			t.Errorf("parameter 0x%.2X: expected 0x%.2X, got 0x%.2X", address, value, got)
+		}
+	}
+
+	if err := radio.WriteParameters(context.Background(), map[byte]byte{RADIOCRAFT_MEMORY_END: 0x00}); err == nil {
+		t.Errorf("expected an error for the reserved address")
+	}
+
+	if err := radio.ExitConfig(); err != nil {
+		t.Fatalf("ExitConfig failed: %s", err)
+	}
+
+	if len(module.pending) != 0 || module.config {
+		t.Errorf("module did not leave config mode")
+	}
+}
+
+func TestRadiocraftTimeout(t *testing.T) {
+	radio := NewRadiocraft(&radiocraftModule{silent: true})
+
+	if err := radio.EnterConfig(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got: %v", err)
+	}
+
+	// A cancelled context stops the reads
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := radio.Configure(ctx, RadiocraftConfig{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got: %v", err)
+	}
+}
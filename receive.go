@@ -0,0 +1,110 @@
+package mbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reads from the device, returns 0 bytes without an error when the read timeout of the device expired
+type readFunc func(buffer []byte) (int, error)
+
+// A readFunc is the io.Reader of a Framer
+func (read readFunc) Read(buffer []byte) (int, error) {
+	return read(buffer)
+}
+
+// Receive the frames of the handle through a channel and the errors while receiving through the error channel.
+// A handle which is not an ErrorStreamer is read with ReceiveFrame.
+func StreamWithErrors(ctx context.Context, handle Handle) (chan Frame, chan error) {
+	if streamer, ok := handle.(ErrorStreamer); ok {
+		return streamer.StreamWithErrors(ctx)
+	}
+
+	return streamFrames(ctx, handle.ReceiveFrame)
+}
+
+// Receive frames until the context is done, receive returns io.EOF or the device is gone (ErrDisconnected, which is
+// sent to the error channel), after which both channels are closed.
+// The errors are dropped when the error channel is full, so an unread error channel does not block the frames.
+func streamFrames(ctx context.Context, receive func() (Frame, error)) (chan Frame, chan error) {
+	stream := make(chan Frame, 1024)
+	errs := make(chan error, 1024)
+
+	go func() {
+		defer close(stream)
+		defer close(errs)
+
+		for {
+			frame, err := receive()
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				// There is nothing more to receive
+				if errors.Is(err, io.EOF) {
+					return
+				}
+
+				if DEBUG {
+					fmt.Printf("Got error while receiving frame: %s\n", err)
+				}
+
+				select {
+				case errs <- err:
+				default:
+				}
+
+				if errors.Is(err, ErrDisconnected) {
+					return
+				}
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case stream <- frame:
+			}
+		}
+	}()
+
+	return stream, errs
+}
+
+// Receive a single wired frame, the read timeout of the device is used as the response timeout.
+// The bytes after the frame are kept by the framer for the next call.
+func receiveWiredFrame(framer *Framer) (*MBusFrame, error) {
+	frame, err := framer.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	return frame.(*MBusFrame), nil
+}
+
+// Read and drop the received bytes until the read timeout expires. A bus which keeps sending is given up on after
+// PACKET_BUFF_SIZE bytes.
+func discardInput(read readFunc) error {
+	var buffer [64]byte
+
+	for discarded := 0; discarded < PACKET_BUFF_SIZE; {
+		nread, err := read(buffer[:])
+		if err != nil {
+			return err
+		}
+
+		if nread == 0 {
+			return nil
+		}
+
+		if DEBUG {
+			fmt.Printf("Discarding %d received bytes\n", nread)
+		}
+		discarded += nread
+	}
+
+	return nil
+}
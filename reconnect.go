@@ -0,0 +1,216 @@
+package mbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ConnectionState int
+
+const (
+	CONNECTION_CONNECTED ConnectionState = iota
+	CONNECTION_DISCONNECTED
+	// The stream stopped, because the context is done, the reconnect attempts are exhausted or the capture file ended
+	CONNECTION_CLOSED
+)
+
+func (state ConnectionState) String() string {
+	switch state {
+	case CONNECTION_CONNECTED:
+		return "connected"
+	case CONNECTION_DISCONNECTED:
+		return "disconnected"
+	case CONNECTION_CLOSED:
+		return "closed"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(state))
+	}
+}
+
+// Reported by ReconnectStream on each change of the connection state and each failed reconnect attempt
+type ConnectionEvent struct {
+	State ConnectionState
+	// The error which broke the connection or failed the reconnect attempt
+	Err error
+	// Number of failed reconnect attempts in a row
+	Attempt int
+	// Delay until the next reconnect attempt
+	Backoff time.Duration
+}
+
+type ReconnectConfig struct {
+	// Delay after the first failed reconnect attempt, doubled after each next failed attempt. Defaults to 1s.
+	MinBackoff time.Duration
+	// Upper limit of the delay between the reconnect attempts. Defaults to 1m.
+	MaxBackoff time.Duration
+	// Stop after this many failed attempts in a row, 0 keeps trying until the context is done
+	MaxAttempts int
+}
+
+// Opens the handle, which is called again to reopen the device when the connection broke
+type DialHandleFunc func(ctx context.Context) (Handle, error)
+
+// Stream the frames of the handle opened by dial, a broken connection is closed and reopened with exponential
+// backoff. Every error which is not a timeout or an invalid frame (including io.EOF and ErrDisconnected) counts as
+// a broken connection. A connection which breaks within the current backoff counts as a failed attempt, so a device
+// which keeps dropping the connection right away is not reopened in a busy loop. A replayed capture file is not
+// reopened, its end closes the stream. The errors and connection events are dropped when their channel is full,
+// all channels are closed when the stream stops.
+func ReconnectStream(ctx context.Context, dial DialHandleFunc, config ReconnectConfig) (chan Frame, chan error, chan ConnectionEvent) {
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = time.Second
+	}
+
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = time.Minute
+	}
+
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = config.MinBackoff
+	}
+
+	stream := make(chan Frame, 1024)
+	errs := make(chan error, 1024)
+	events := make(chan ConnectionEvent, 64)
+
+	report := func(event ConnectionEvent) {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+
+	go func() {
+		defer close(stream)
+		defer close(errs)
+		defer close(events)
+
+		var handle Handle
+		var connected time.Time
+		attempt := 0
+		backoff := config.MinBackoff
+
+		defer func() {
+			if handle != nil {
+				handle.Close()
+			}
+		}()
+
+		// Wait before the next attempt, returns false when the stream has to stop
+		retry := func(err error) bool {
+			attempt++
+
+			if config.MaxAttempts > 0 && attempt >= config.MaxAttempts {
+				report(ConnectionEvent{State: CONNECTION_CLOSED, Err: err, Attempt: attempt})
+				return false
+			}
+
+			report(ConnectionEvent{State: CONNECTION_DISCONNECTED, Err: err, Attempt: attempt, Backoff: backoff})
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				report(ConnectionEvent{State: CONNECTION_CLOSED, Err: ctx.Err(), Attempt: attempt})
+				return false
+			case <-timer.C:
+			}
+
+			if backoff *= 2; backoff > config.MaxBackoff {
+				backoff = config.MaxBackoff
+			}
+			return true
+		}
+
+		for {
+			if handle == nil {
+				opened, err := dial(ctx)
+				if ctx.Err() != nil {
+					if err == nil {
+						opened.Close()
+					}
+
+					report(ConnectionEvent{State: CONNECTION_CLOSED, Err: ctx.Err()})
+					return
+				}
+
+				if err != nil {
+					if !retry(err) {
+						return
+					}
+					continue
+				}
+
+				handle = opened
+				connected = time.Now()
+
+				report(ConnectionEvent{State: CONNECTION_CONNECTED})
+			}
+
+			frame, err := handle.ReceiveFrame()
+			if ctx.Err() != nil {
+				report(ConnectionEvent{State: CONNECTION_CLOSED, Err: ctx.Err()})
+				return
+			}
+
+			if err != nil {
+				if isConnectionError(err) {
+					if _, ok := handle.(*MbusReplayHandle); ok {
+						report(ConnectionEvent{State: CONNECTION_CLOSED, Err: err})
+						return
+					}
+
+					if DEBUG {
+						fmt.Printf("Connection broken, reconnecting: %s\n", err)
+					}
+
+					handle.Close()
+					handle = nil
+
+					// The connection did not last, wait like after a failed attempt
+					if time.Since(connected) < backoff {
+						if !retry(err) {
+							return
+						}
+						continue
+					}
+
+					attempt = 0
+					backoff = config.MinBackoff
+
+					report(ConnectionEvent{State: CONNECTION_DISCONNECTED, Err: err})
+					continue
+				}
+
+				select {
+				case errs <- err:
+				default:
+				}
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				report(ConnectionEvent{State: CONNECTION_CLOSED, Err: ctx.Err()})
+				return
+			case stream <- frame:
+			}
+		}
+	}()
+
+	return stream, errs, events
+}
+
+// Stream the frames of the connection string, see Dial and ReconnectStream
+func DialStream(ctx context.Context, connection string, config ReconnectConfig) (chan Frame, chan error, chan ConnectionEvent) {
+	return ReconnectStream(ctx, func(ctx context.Context) (Handle, error) {
+		return Dial(ctx, connection)
+	}, config)
+}
+
+// Timeouts and invalid frames are expected on a working connection, every other error means the device is gone
+func isConnectionError(err error) bool {
+	return !errors.Is(err, ErrTimeout) && !errors.Is(err, ErrInvalidFrame)
+}
@@ -0,0 +1,161 @@
+package mbus
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReconnectStream(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The first connections deliver a single telegram before they break, the last one stays open
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			conn.Write(testFrame)
+			if i < 2 {
+				conn.Close()
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dials := 0
+	dial := func(ctx context.Context) (Handle, error) {
+		// The first attempts fail, like a device which is not plugged in yet
+		if dials++; dials <= 2 {
+			return nil, errors.New("no such device")
+		}
+
+		return NewTCPClient(listener.Addr().String(), TCPConfig{
+			ConnectTimeout: time.Second,
+			ReadTimeout:    10 * time.Millisecond,
+		})
+	}
+
+	stream, _, events := ReconnectStream(ctx, dial, ReconnectConfig{MinBackoff: 50 * time.Millisecond})
+
+	for i := 0; i < 3; i++ {
+		if _, ok := <-stream; !ok {
+			t.Fatalf("expected 3 frames, the stream closed after: %d", i)
+		}
+	}
+	cancel()
+
+	for range stream {
+	}
+
+	var states []ConnectionEvent
+	for event := range events {
+		states = append(states, event)
+	}
+
+	// Two failed attempts, after which the first two connections break right after their frame
+	expected := []ConnectionState{
+		CONNECTION_DISCONNECTED, CONNECTION_DISCONNECTED, CONNECTION_CONNECTED,
+		CONNECTION_DISCONNECTED, CONNECTION_CONNECTED,
+		CONNECTION_DISCONNECTED, CONNECTION_CONNECTED,
+	}
+
+	if len(states) != len(expected)+1 {
+		t.Fatalf("expected %d events, got: %v", len(expected)+1, states)
+	}
+
+	for i, state := range expected {
+		if states[i].State != state {
+			t.Fatalf("event %d: expected state %s, got: %+v", i, state, states[i])
+		}
+	}
+
+	if states[1].Attempt != 2 || states[1].Backoff != 100*time.Millisecond {
+		t.Fatalf("expected the second attempt with a doubled backoff, got: %+v", states[1])
+	}
+
+	if !errors.Is(states[3].Err, io.EOF) {
+		t.Fatalf("expected the connection to break with EOF, got: %v", states[3].Err)
+	}
+
+	// The connections which did not last count as failed attempts, the backoff is not reset
+	if states[3].Attempt != 3 || states[3].Backoff != 200*time.Millisecond || states[5].Attempt != 4 {
+		t.Fatalf("expected the broken connections to back off, got: %+v %+v", states[3], states[5])
+	}
+
+	if last := states[len(states)-1]; last.State != CONNECTION_CLOSED {
+		t.Fatalf("expected the stream to be closed, got: %+v", last)
+	}
+}
+
+func TestReconnectStreamMaxAttempts(t *testing.T) {
+	dial := func(ctx context.Context) (Handle, error) {
+		return nil, errors.New("no such device")
+	}
+
+	stream, _, events := ReconnectStream(context.Background(), dial, ReconnectConfig{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  2 * time.Millisecond,
+		MaxAttempts: 4,
+	})
+
+	if _, ok := <-stream; ok {
+		t.Fatalf("expected no frames")
+	}
+
+	var last ConnectionEvent
+	for event := range events {
+		last = event
+
+		if event.Backoff > 2*time.Millisecond {
+			t.Fatalf("expected the backoff to be limited to 2ms, got: %s", event.Backoff)
+		}
+	}
+
+	if last.State != CONNECTION_CLOSED || last.Attempt != 4 {
+		t.Fatalf("expected the stream to close after 4 attempts, got: %+v", last)
+	}
+}
+
+func TestReconnectStreamReplay(t *testing.T) {
+	path := writeTestCapture(t, hex.EncodeToString(testFrame)+"\nnot a telegram\n"+hex.EncodeToString(testFrame)+"\n")
+
+	stream, errs, events := DialStream(context.Background(), "file://"+path, ReconnectConfig{})
+
+	frames := 0
+	for range stream {
+		frames++
+	}
+
+	if frames != 2 {
+		t.Fatalf("expected 2 frames, got: %d", frames)
+	}
+
+	// The invalid line does not restart the replay
+	if err := <-errs; !errors.Is(err, ErrInvalidFrame) {
+		t.Fatalf("expected an invalid frame error, got: %v", err)
+	}
+
+	var states []ConnectionEvent
+	for event := range events {
+		states = append(states, event)
+	}
+
+	// The end of the capture file closes the stream, it is not replayed again
+	if len(states) != 2 || states[0].State != CONNECTION_CONNECTED || states[1].State != CONNECTION_CLOSED || !errors.Is(states[1].Err, io.EOF) {
+		t.Fatalf("expected the stream to close at the end of the capture file, got: %+v", states)
+	}
+}
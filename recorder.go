@@ -0,0 +1,299 @@
+package mbus
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RecorderConfig struct {
+	// Name of the transport the telegrams are received with, e.g. serial or tcp
+	Transport string
+
+	// Rotate the capture file when it reaches this size in bytes, 0 disables the rotation
+	MaxSize int64
+	// Number of rotated capture files to keep, 0 keeps all
+	MaxFiles int
+	// Compress the rotated capture files with gzip
+	Gzip bool
+
+	// Called by Tap when a frame could not be recorded, the frame is passed on regardless
+	OnError func(frame Frame, err error)
+}
+
+// Records the raw telegrams in the capture file format of MbusReplayHandle, each line holds:
+//
+//	<timestamp> <hex telegram> [rssi] transport=<name> parsed=<true|false|encrypted> [lqi=<lqi>] [type=wired]
+//
+// The frames of a wired M-Bus (*MBusFrame) are marked with type=wired, so they are replayed as wired frames.
+// The rotated files are named <path>.1, <path>.2, ... (with .gz when compressed), <path>.1 is the most recent.
+type Recorder struct {
+	path   string
+	config RecorderConfig
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+func NewRecorder(path string, config RecorderConfig) (*Recorder, error) {
+	recorder := &Recorder{
+		path:   path,
+		config: config,
+	}
+
+	if err := recorder.open(); err != nil {
+		return nil, err
+	}
+
+	return recorder, nil
+}
+
+func (recorder *Recorder) open() error {
+	file, err := os.OpenFile(recorder.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	recorder.file = file
+	recorder.size = info.Size()
+	return nil
+}
+
+// Append the raw telegram of the frame to the capture file
+func (recorder *Recorder) Record(frame Frame) error {
+	data := rawFrameData(frame)
+	if len(data) == 0 {
+		return fmt.Errorf("frame has no raw data")
+	}
+
+	timestamp := time.Now()
+	var rssi, lqi, kind string
+
+	if wirelessFrame, ok := frame.(*WMBusFrame); ok {
+		if !wirelessFrame.Timestamp.IsZero() {
+			timestamp = wirelessFrame.Timestamp
+		}
+
+		if wirelessFrame.RSSI != 0 {
+			rssi = fmt.Sprintf(" %d", wirelessFrame.RSSI)
+		}
+
+		if wirelessFrame.LQI != 0 {
+			lqi = fmt.Sprintf(" lqi=%d", wirelessFrame.LQI)
+		}
+	}
+
+	if _, ok := frame.(*MBusFrame); ok {
+		kind = " type=wired"
+	}
+
+	transport := recorder.config.Transport
+	if transport == "" {
+		transport = "unknown"
+	}
+
+	line := fmt.Sprintf(
+		"%s %s%s transport=%s parsed=%s%s%s\n",
+		timestamp.Format(time.RFC3339Nano),
+		strings.ToUpper(hex.EncodeToString(data)),
+		rssi,
+		transport,
+		parseStatus(frame, data),
+		lqi,
+		kind,
+	)
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recorder.file == nil {
+		return fmt.Errorf("recorder is closed")
+	}
+
+	if recorder.config.MaxSize > 0 && recorder.size > 0 && recorder.size+int64(len(line)) > recorder.config.MaxSize {
+		if err := recorder.rotate(); err != nil {
+			return err
+		}
+	}
+
+	written, err := recorder.file.WriteString(line)
+	recorder.size += int64(written)
+
+	return err
+}
+
+// Record every frame of the stream and pass it on, the returned channel is closed when the stream is closed
+func (recorder *Recorder) Tap(ctx context.Context, stream chan Frame) chan Frame {
+	tapped := make(chan Frame, cap(stream))
+
+	go func() {
+		defer close(tapped)
+
+		for frame := range stream {
+			if err := recorder.Record(frame); err != nil {
+				if recorder.config.OnError != nil {
+					recorder.config.OnError(frame, err)
+				} else if DEBUG {
+					fmt.Printf("Got error while recording frame: %s\n", err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case tapped <- frame:
+			}
+		}
+	}()
+
+	return tapped
+}
+
+func (recorder *Recorder) Close() error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recorder.file == nil {
+		return nil
+	}
+
+	err := recorder.file.Close()
+	recorder.file = nil
+
+	return err
+}
+
+// Move the capture file to <path>.1 and start a new one, the older files shift one number up
+func (recorder *Recorder) rotate() error {
+	if err := recorder.file.Close(); err != nil {
+		return err
+	}
+	recorder.file = nil
+
+	extension := ""
+	if recorder.config.Gzip {
+		extension = ".gz"
+	}
+
+	rotated := func(n int) string {
+		return fmt.Sprintf("%s.%d%s", recorder.path, n, extension)
+	}
+
+	// Find the last rotated file, the ones beyond MaxFiles are removed
+	last := 1
+	for ; ; last++ {
+		if _, err := os.Stat(rotated(last)); os.IsNotExist(err) {
+			break
+		}
+	}
+
+	for n := last - 1; n >= 1; n-- {
+		if recorder.config.MaxFiles > 0 && n >= recorder.config.MaxFiles {
+			if err := os.Remove(rotated(n)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.Rename(rotated(n), rotated(n+1)); err != nil {
+			return err
+		}
+	}
+
+	if recorder.config.Gzip {
+		if err := gzipFile(recorder.path, rotated(1)); err != nil {
+			return err
+		}
+	} else if err := os.Rename(recorder.path, rotated(1)); err != nil {
+		return err
+	}
+
+	return recorder.open()
+}
+
+// Compress the source file into the destination file and remove the source file
+func gzipFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+
+	writer := gzip.NewWriter(out)
+	if _, err := io.Copy(writer, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		out.Close()
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	in.Close()
+	return os.Remove(source)
+}
+
+// The bytes as they were received, frames without raw data are encoded again
+func rawFrameData(frame Frame) []byte {
+	if wirelessFrame, ok := frame.(*WMBusFrame); ok && len(wirelessFrame.Raw) > 0 {
+		return wirelessFrame.Raw
+	}
+
+	data, length := encodeFrame(frame)
+	return data[:length]
+}
+
+// Check if the data of the telegram can be parsed, without touching the received frame
+func parseStatus(frame Frame, data []byte) string {
+	var parsed Frame
+
+	switch frame.(type) {
+	case *MBusFrame:
+		wiredFrame, err := parseWiredCapture(data)
+		if err != nil {
+			return "false"
+		}
+		parsed = wiredFrame
+		break
+	default:
+		wirelessFrame, err := parseWirelessCapture(data)
+		if err != nil {
+			return "false"
+		}
+		parsed = wirelessFrame
+		break
+	}
+
+	if parsed.HasEncryptionMode() && !parsed.IsDecrypted() {
+		return "encrypted"
+	}
+
+	if err := parsed.DataParse(); err != nil {
+		return "false"
+	}
+
+	return "true"
+}
@@ -0,0 +1,160 @@
+package mbus
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "capture.hex")
+
+	// Every telegram starts a new file
+	recorder, err := NewRecorder(path, RecorderConfig{Transport: "serial", MaxSize: 1, MaxFiles: 2, Gzip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	stream := make(chan Frame, 4)
+	for i := 0; i < 3; i++ {
+		frame, err := parseCaptureLine(hex.EncodeToString(testFrame) + " -70")
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame.Timestamp = time.Date(2021, time.March, 14, 15, 9, 26+i, 0, time.UTC)
+		stream <- frame
+	}
+	close(stream)
+
+	tapped := 0
+	for range recorder.Tap(context.Background(), stream) {
+		tapped++
+	}
+
+	if tapped != 3 {
+		t.Fatalf("expected 3 tapped frames, got: %d", tapped)
+	}
+
+	wired := NewWiredMBusFrame()
+	if _, err := ParseWiredMBusData(wired, &testWiredFrame, len(testWiredFrame)); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Record(wired); err != nil {
+		t.Fatal(err)
+	}
+
+	// The oldest telegrams are removed, only 2 rotated files are kept
+	for _, name := range []string{"capture.hex", "capture.hex.1.gz", "capture.hex.2.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "capture.hex.3.gz")); !os.IsNotExist(err) {
+		t.Fatalf("expected capture.hex.3.gz to be removed")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(string(content), "transport=serial parsed=true type=wired\n") {
+		t.Fatalf("unexpected recorded wired telegram: %s", content)
+	}
+
+	// The wired telegram is replayed as a wired frame
+	wiredHandle, err := NewReplayClient(path, ReplayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wiredHandle.Close()
+
+	wiredFrame, err := wiredHandle.ReceiveFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayedWired, ok := wiredFrame.(*MBusFrame)
+	if !ok {
+		t.Fatalf("expected a wired frame, got: %T", wiredFrame)
+	}
+
+	if err := replayedWired.DataParse(); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := replayedWired.DecodeFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.SerialNumber != "12345678" || len(decoded.DataRecords) != 3 {
+		t.Fatalf("unexpected replayed wired frame: %+v", decoded)
+	}
+
+	// The rotated files can be replayed
+	handle, err := NewReplayClient(filepath.Join(dir, "capture.hex.1.gz"), ReplayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	frame, err := handle.ReceiveFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := frame.(*WMBusFrame)
+	if replayed.RSSI != -70 || replayed.Timestamp.Second() != 28 || string(replayed.Raw) != string(testFrame) {
+		t.Fatalf("unexpected replayed frame: %d %s % X", replayed.RSSI, replayed.Timestamp, replayed.Raw)
+	}
+}
+
+func TestRecorderTapError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var errs []error
+	recorder, err := NewRecorder(filepath.Join(dir, "capture.hex"), RecorderConfig{
+		OnError: func(frame Frame, err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.Close()
+
+	frame, err := parseCaptureLine(hex.EncodeToString(testFrame))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := make(chan Frame, 1)
+	stream <- frame
+	close(stream)
+
+	// The frame is passed on although it could not be recorded
+	tapped := 0
+	for range recorder.Tap(context.Background(), stream) {
+		tapped++
+	}
+
+	if tapped != 1 || len(errs) != 1 {
+		t.Fatalf("expected 1 tapped frame and 1 error, got: %d and %v", tapped, errs)
+	}
+}
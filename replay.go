@@ -0,0 +1,299 @@
+package mbus
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReplayConfig struct {
+	// Wait the recorded time between the telegrams, only applies to telegrams with a timestamp
+	RealTime bool
+}
+
+// Handle which replays the telegrams of a capture file. Each line holds a single telegram:
+//
+//	[timestamp] <hex telegram> [rssi] [key=value ...]
+//
+// The optional timestamp is in RFC 3339 format, the optional RSSI in dBm. Of the key=value fields written by the
+// Recorder only lqi and type=wired are used, the latter marks a frame of a wired M-Bus (returned as *MBusFrame). Empty lines and lines starting with # are skipped. Files ending with .gz are decompressed.
+type MbusReplayHandle struct {
+	MbusHandle
+	Fd *os.File
+
+	config  ReplayConfig
+	scanner *bufio.Scanner
+	line    int
+
+	// Recorded timestamp of the previous telegram and the time it was replayed
+	recorded time.Time
+	replayed time.Time
+}
+
+func NewReplayClient(path string, config ReplayConfig) (Handle, error) {
+	client := &MbusReplayHandle{
+		Fd: nil,
+	}
+
+	if err := client.Open(path, config); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (handle *MbusReplayHandle) Open(path string, config interface{}) error {
+	replayConfig, ok := config.(ReplayConfig)
+	if !ok {
+		return fmt.Errorf("expected a ReplayConfig, got: %T", config)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		if reader, err = gzip.NewReader(file); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	handle.Fd = file
+	handle.config = replayConfig
+	handle.scanner = bufio.NewScanner(reader)
+	handle.line = 0
+	handle.recorded = time.Time{}
+	handle.replayed = time.Time{}
+	return nil
+}
+
+func (handle *MbusReplayHandle) Stream(ctx context.Context) chan Frame {
+	stream, _ := handle.StreamWithErrors(ctx)
+	return stream
+}
+
+// The channels are closed when all telegrams are replayed, invalid lines are sent to the error channel and skipped
+func (handle *MbusReplayHandle) StreamWithErrors(ctx context.Context) (chan Frame, chan error) {
+	return streamFrames(ctx, func() (Frame, error) {
+		return handle.receiveFrame(ctx)
+	})
+}
+
+func (handle *MbusReplayHandle) Close() error {
+	if err := handle.Fd.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (handle *MbusReplayHandle) Send(frame Frame) error {
+	return fmt.Errorf("unable to send frames to a capture file")
+}
+
+// Returns the next telegram of the capture file, io.EOF when all telegrams are replayed
+func (handle *MbusReplayHandle) ReceiveFrame() (Frame, error) {
+	return handle.receiveFrame(context.Background())
+}
+
+func (handle *MbusReplayHandle) receiveFrame(ctx context.Context) (Frame, error) {
+	for handle.scanner.Scan() {
+		handle.line++
+
+		line := strings.TrimSpace(handle.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// A line which does not hold a telegram is an invalid frame, the next lines are still replayed
+		var frame Frame
+		capture, err := splitCaptureLine(line)
+		if err == nil && capture.wired {
+			frame, err = parseWiredCapture(capture.data)
+		} else if err == nil {
+			frame, err = capture.wirelessFrame()
+		}
+
+		if err != nil && !errors.Is(err, ErrInvalidFrame) {
+			return nil, fmt.Errorf("line %d: %w: %s", handle.line, ErrInvalidFrame, err)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", handle.line, err)
+		}
+
+		if err := handle.pace(ctx, capture.timestamp); err != nil {
+			return nil, err
+		}
+
+		return frame, nil
+	}
+
+	if err := handle.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// Wait until the recorded time between the previous and this telegram has passed
+func (handle *MbusReplayHandle) pace(ctx context.Context, recorded time.Time) error {
+	if !handle.config.RealTime || recorded.IsZero() {
+		return nil
+	}
+
+	if !handle.recorded.IsZero() {
+		wait := recorded.Sub(handle.recorded) - time.Since(handle.replayed)
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+
+	handle.recorded = recorded
+	handle.replayed = time.Now()
+	return nil
+}
+
+// The fields of a line of a capture file
+type captureLine struct {
+	timestamp time.Time
+	data      []byte
+	rssi      string
+	lqi       string
+	// The telegram was received from a wired M-Bus (type=wired)
+	wired bool
+}
+
+// Split a line of a capture file: [timestamp] <hex telegram> [rssi] [key=value ...]
+func splitCaptureLine(line string) (*captureLine, error) {
+	capture := &captureLine{}
+
+	var fields []string
+	for _, field := range strings.Fields(line) {
+		if strings.HasPrefix(field, "lqi=") {
+			capture.lqi = strings.TrimPrefix(field, "lqi=")
+		} else if field == "type=wired" {
+			capture.wired = true
+		} else if !strings.Contains(field, "=") {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) > 1 {
+		if parsed, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+			capture.timestamp = parsed
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("expected [timestamp] <hex telegram> [rssi], got: %s", line)
+	}
+
+	data, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid telegram: %s", err)
+	}
+	capture.data = data
+
+	if len(fields) == 2 {
+		capture.rssi = fields[1]
+	}
+
+	return capture, nil
+}
+
+// Parse a line of a capture file which holds a wireless telegram
+func parseCaptureLine(line string) (*WMBusFrame, error) {
+	capture, err := splitCaptureLine(line)
+	if err != nil {
+		return nil, err
+	}
+
+	if capture.wired {
+		return nil, fmt.Errorf("expected a wireless telegram, got a wired telegram")
+	}
+
+	return capture.wirelessFrame()
+}
+
+func (capture *captureLine) wirelessFrame() (*WMBusFrame, error) {
+	frame, err := parseWirelessCapture(capture.data)
+	if err != nil {
+		return nil, err
+	}
+
+	if capture.rssi != "" {
+		if frame.RSSI, err = strconv.Atoi(capture.rssi); err != nil {
+			return nil, fmt.Errorf("invalid RSSI '%s'", capture.rssi)
+		}
+	}
+
+	if capture.lqi != "" {
+		if frame.LQI, err = strconv.Atoi(capture.lqi); err != nil {
+			return nil, fmt.Errorf("invalid LQI '%s'", capture.lqi)
+		}
+	}
+
+	frame.Timestamp = capture.timestamp
+	return frame, nil
+}
+
+// Parse a recorded wired frame (ACK, short, control or long frame)
+func parseWiredCapture(data []byte) (*MBusFrame, error) {
+	frame := NewWiredMBusFrame()
+
+	result, err := ParseWiredMBusData(frame, &data, len(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.GotFrame || result.Remaining != 0 {
+		return nil, fmt.Errorf("incomplete telegram, %d bytes missing", result.Remaining)
+	}
+
+	return frame, nil
+}
+
+// Parse a recorded telegram, which holds the link layer CRCs when the telegram does not parse without them
+func parseWirelessCapture(data []byte) (*WMBusFrame, error) {
+	frame := NewWirelessMBusFrame()
+
+	result, err := ParseWirelessMBusData(frame, &data, len(data))
+	if err == nil && result.GotFrame && result.Remaining == 0 {
+		frame.Raw = data
+		return frame, nil
+	}
+
+	if len(data) > 0 && data[0] == FRAME_LONG_START {
+		crcFrame, _, crcErr := decodeWirelessFrame(data, len(data), true, ProfileNone)
+		if crcErr == nil && crcFrame != nil && len(crcFrame.(*WMBusFrame).Raw) == len(data) {
+			return crcFrame.(*WMBusFrame), nil
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("incomplete telegram, %d bytes missing", result.Remaining)
+}
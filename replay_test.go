@@ -0,0 +1,130 @@
+package mbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func writeTestCapture(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "capture-*.hex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(file.Name()) })
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	return file.Name()
+}
+
+func TestReplay(t *testing.T) {
+	telegram := hex.EncodeToString(testFrame)
+	path := writeTestCapture(t, fmt.Sprintf(
+		"# capture\n2021-03-14T15:09:26Z %s -67\n\n%s\nnot-a-telegram\n2021-03-14T15:09:26.2Z %s\n",
+		telegram, telegram, telegram,
+	))
+
+	handle, err := Dial(context.Background(), "file://"+path+"?realtime=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	start := time.Now()
+
+	var frames []*WMBusFrame
+	for frame := range handle.Stream(context.Background()) {
+		frames = append(frames, frame.(*WMBusFrame))
+	}
+
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 frames, got: %d", len(frames))
+	}
+
+	if !frames[0].Timestamp.Equal(time.Date(2021, time.March, 14, 15, 9, 26, 0, time.UTC)) || frames[0].RSSI != -67 {
+		t.Fatalf("unexpected timestamp or RSSI: %s %d", frames[0].Timestamp, frames[0].RSSI)
+	}
+
+	if !frames[1].Timestamp.IsZero() || frames[1].RSSI != 0 {
+		t.Fatalf("expected no timestamp and RSSI, got: %s %d", frames[1].Timestamp, frames[1].RSSI)
+	}
+
+	// The last telegram was recorded 200ms after the first one
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected the replay to take at least 200ms, took: %s", elapsed)
+	}
+
+	if _, err := handle.ReceiveFrame(); err != io.EOF {
+		t.Fatalf("expected EOF, got: %v", err)
+	}
+}
+
+func TestReplayStreamWithErrors(t *testing.T) {
+	// A telegram with an unknown CI-field
+	unknown := append([]byte{}, testFrame...)
+	unknown[11] = 0x00
+
+	path := writeTestCapture(t, fmt.Sprintf(
+		"%s\n%s\n%s\n", hex.EncodeToString(testFrame), hex.EncodeToString(unknown), hex.EncodeToString(testFrame),
+	))
+
+	handle, err := NewReplayClient(path, ReplayConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	stream, errs := StreamWithErrors(context.Background(), handle)
+
+	frames := 0
+	for range stream {
+		frames++
+	}
+
+	if frames != 2 {
+		t.Fatalf("expected 2 frames, got: %d", frames)
+	}
+
+	err = <-errs
+	if !errors.Is(err, ErrInvalidFrame) || !errors.Is(err, ErrUnsupported) || errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected an unsupported frame error, got: %v", err)
+	}
+
+	var frameErr *FrameError
+	if !errors.As(err, &frameErr) {
+		t.Fatalf("expected a FrameError, got: %T", err)
+	}
+
+	if frameErr.Offset != 11 || !bytes.Equal(frameErr.Raw, unknown) {
+		t.Fatalf("unexpected offset or raw bytes: %d % X", frameErr.Offset, frameErr.Raw)
+	}
+
+	if err, ok := <-errs; ok {
+		t.Fatalf("expected the error channel to be closed, got: %v", err)
+	}
+}
+
+func TestStreamWithErrorsFallback(t *testing.T) {
+	// The test bus is not an ErrorStreamer, it is read with ReceiveFrame
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, errs := StreamWithErrors(ctx, newTestBus())
+
+	if err := <-errs; !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got: %v", err)
+	}
+
+	cancel()
+	for range stream {
+	}
+}
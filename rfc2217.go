@@ -0,0 +1,501 @@
+package mbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// Telnet commands and options, RFC 854 and RFC 856
+const (
+	TELNET_IAC  = 0xFF
+	TELNET_DONT = 0xFE
+	TELNET_DO   = 0xFD
+	TELNET_WONT = 0xFC
+	TELNET_WILL = 0xFB
+	TELNET_SB   = 0xFA
+	TELNET_SE   = 0xF0
+
+	TELNET_OPTION_BINARY   = 0x00
+	TELNET_OPTION_SGA      = 0x03
+	TELNET_OPTION_COM_PORT = 0x2C
+)
+
+// COM port control commands send by the client, the server answers with the command + 100. RFC 2217
+const (
+	RFC2217_SET_BAUDRATE = 1
+	RFC2217_SET_DATASIZE = 2
+	RFC2217_SET_PARITY   = 3
+	RFC2217_SET_STOPSIZE = 4
+	RFC2217_SET_CONTROL  = 5
+
+	RFC2217_SERVER_OFFSET = 100
+
+	// Value of SET_CONTROL to disable flow control
+	RFC2217_CONTROL_NO_FLOW_CONTROL = 1
+)
+
+// Maximum time to wait for the connection and for the server to acknowledge a COM port setting
+var RFC2217Timeout = 5 * time.Second
+
+var rfc2217Parity = map[serial.Parity]byte{
+	0:                  1,
+	serial.ParityNone:  1,
+	serial.ParityOdd:   2,
+	serial.ParityEven:  3,
+	serial.ParityMark:  4,
+	serial.ParitySpace: 5,
+}
+
+var rfc2217StopSize = map[serial.StopBits]byte{
+	0:                1,
+	serial.Stop1:     1,
+	serial.Stop2:     2,
+	serial.Stop1Half: 3,
+}
+
+// Handle for serial device servers which control the remote serial port with RFC 2217 (Telnet COM port control).
+// After the negotiation it behaves like MbusSerialHandle.
+type MbusRFC2217Handle struct {
+	MbusHandle
+	Fd net.Conn
+
+	// Kept to change the baud rate of the remote port
+	device string
+	config SerialConfig
+	// The ReadTimeout before SetLocalBaudRate raised it for a slower baud rate
+	readTimeout time.Duration
+
+	// Telnet decoder state
+	state     int
+	command   byte
+	sbData    []byte
+	responses map[byte][]byte
+	refused   bool
+
+	// Received data which has not been read yet and the buffer for reading the connection
+	pending []byte
+	scratch []byte
+
+	// Framers for the wireless frames and for the answers of the wired slaves
+	framer      *Framer
+	wiredFramer *Framer
+}
+
+// States of the telnet decoder
+const (
+	telnetStateData = iota
+	telnetStateIAC
+	telnetStateOption
+	telnetStateSB
+	telnetStateSBIAC
+)
+
+func NewRFC2217Client(address string, config SerialConfig) (Handle, error) {
+	client, err := newRFC2217Client(context.Background(), address, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func newRFC2217Client(ctx context.Context, address string, config SerialConfig) (*MbusRFC2217Handle, error) {
+	client := &MbusRFC2217Handle{
+		Fd: nil,
+		MbusHandle: MbusHandle{
+			MaxDataRetry:   3,
+			MaxSearchRetry: 3,
+			IsSerial:       true,
+		},
+	}
+	client.wired = client
+
+	if err := client.open(ctx, address, config); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Connect to the device server at the given address (host:port) and configure its serial port
+func (handle *MbusRFC2217Handle) Open(address string, config interface{}) error {
+	serialConfig, ok := config.(SerialConfig)
+	if !ok {
+		return fmt.Errorf("expected a SerialConfig, got: %T", config)
+	}
+
+	return handle.open(context.Background(), address, serialConfig)
+}
+
+func (handle *MbusRFC2217Handle) open(ctx context.Context, address string, serialConfig SerialConfig) error {
+	dialer := net.Dialer{Timeout: RFC2217Timeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+
+	handle.Fd = conn
+	handle.scratch = make([]byte, PACKET_BUFF_SIZE)
+	handle.framer = NewWirelessFramer(readFunc(handle.read))
+	handle.wiredFramer = NewWiredFramer(readFunc(handle.read))
+	handle.device = address
+	handle.state = telnetStateData
+	handle.responses = map[byte][]byte{}
+	handle.refused = false
+	handle.pending = nil
+
+	if err := handle.negotiate(serialConfig); err != nil {
+		conn.Close()
+		return err
+	}
+
+	handle.config = serialConfig
+	handle.readTimeout = serialConfig.ReadTimeout
+	return nil
+}
+
+func (handle *MbusRFC2217Handle) negotiate(config SerialConfig) error {
+	if _, err := handle.Fd.Write([]byte{
+		TELNET_IAC, TELNET_WILL, TELNET_OPTION_COM_PORT,
+		TELNET_IAC, TELNET_WILL, TELNET_OPTION_BINARY,
+		TELNET_IAC, TELNET_DO, TELNET_OPTION_BINARY,
+		TELNET_IAC, TELNET_DO, TELNET_OPTION_SGA,
+	}); err != nil {
+		return err
+	}
+
+	parity, ok := rfc2217Parity[config.Parity]
+	if !ok {
+		return serial.ErrBadParity
+	}
+
+	stopSize, ok := rfc2217StopSize[config.StopBits]
+	if !ok {
+		return serial.ErrBadStopBits
+	}
+
+	size := config.Size
+	if size == 0 {
+		size = serial.DefaultSize
+	}
+
+	if err := handle.setBaudRate(config.Baud); err != nil {
+		return err
+	}
+
+	settings := []struct {
+		command byte
+		value   byte
+	}{
+		{RFC2217_SET_DATASIZE, size},
+		{RFC2217_SET_PARITY, parity},
+		{RFC2217_SET_STOPSIZE, stopSize},
+		{RFC2217_SET_CONTROL, RFC2217_CONTROL_NO_FLOW_CONTROL},
+	}
+
+	for _, setting := range settings {
+		if err := handle.setComPort(setting.command, []byte{setting.value}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (handle *MbusRFC2217Handle) setBaudRate(baud int) error {
+	value := make([]byte, 4)
+	binary.BigEndian.PutUint32(value, uint32(baud))
+
+	return handle.setComPort(RFC2217_SET_BAUDRATE, value)
+}
+
+// Send a COM port control command and wait until the server acknowledges it.
+// The server answers with the value it applied, a different value means the setting is not supported.
+func (handle *MbusRFC2217Handle) setComPort(command byte, value []byte) error {
+	delete(handle.responses, command+RFC2217_SERVER_OFFSET)
+
+	request := []byte{TELNET_IAC, TELNET_SB, TELNET_OPTION_COM_PORT, command}
+	request = append(request, escapeTelnet(value)...)
+	request = append(request, TELNET_IAC, TELNET_SE)
+
+	if _, err := handle.Fd.Write(request); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(RFC2217Timeout)
+
+	for {
+		if handle.refused {
+			return fmt.Errorf("device server refused the COM port control option")
+		}
+
+		if applied, ok := handle.responses[command+RFC2217_SERVER_OFFSET]; ok {
+			if !bytes.Equal(applied, value) {
+				return fmt.Errorf("device server applied % X instead of % X for COM port command %d", applied, value, command)
+			}
+			return nil
+		}
+
+		if err := handle.Fd.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+
+		nread, err := handle.Fd.Read(handle.scratch)
+		if err != nil {
+			return fmt.Errorf("device server did not acknowledge COM port command %d: %w", command, err)
+		}
+
+		handle.pending = append(handle.pending, handle.decode(handle.scratch[:nread])...)
+	}
+}
+
+func (handle *MbusRFC2217Handle) BaudRate() int {
+	return handle.config.Baud
+}
+
+// Change the baud rate of the remote serial port
+func (handle *MbusRFC2217Handle) SetLocalBaudRate(baud int) error {
+	if err := handle.setBaudRate(baud); err != nil {
+		return err
+	}
+
+	handle.config.Baud = baud
+	handle.config.ReadTimeout = baudReadTimeout(handle.readTimeout, baud)
+	return nil
+}
+
+func (handle *MbusRFC2217Handle) Stream(ctx context.Context) chan Frame {
+	stream, _ := handle.StreamWithErrors(ctx)
+	return stream
+}
+
+func (handle *MbusRFC2217Handle) StreamWithErrors(ctx context.Context) (chan Frame, chan error) {
+	return streamFrames(ctx, handle.ReceiveFrame)
+}
+
+func (handle *MbusRFC2217Handle) Close() error {
+	if err := handle.Fd.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (handle *MbusRFC2217Handle) Send(frame Frame) error {
+	data, length := encodeFrame(frame)
+	if length == 0 {
+		return fmt.Errorf("unable to encode frame")
+	}
+
+	if DEBUG {
+		fmt.Printf("Sending frame [size = %d]\n", length)
+
+		for i := 0; i < length; i++ {
+			fmt.Printf("%.2X ", data[i])
+		}
+		fmt.Println()
+	}
+
+	return handle.WriteRaw(data[:length])
+}
+
+// Write the bytes as is to the serial port of the server, e.g. to configure the dongle
+func (handle *MbusRFC2217Handle) WriteRaw(data []byte) error {
+	escaped := escapeTelnet(data)
+
+	written, err := handle.Fd.Write(escaped)
+	if err != nil {
+		return err
+	}
+
+	if written != len(escaped) {
+		return &ShortWriteError{
+			Written:  written,
+			Expected: len(escaped),
+		}
+	}
+
+	return nil
+}
+
+// Read the received bytes of the serial port as is, the bytes buffered for the next frame are discarded
+func (handle *MbusRFC2217Handle) ReadRaw(buffer []byte) (int, error) {
+	handle.framer.Reset()
+	handle.wiredFramer.Reset()
+	return handle.read(buffer)
+}
+
+// Receive the next wireless frame, the bytes after it are buffered for the next call
+func (handle *MbusRFC2217Handle) ReceiveFrame() (Frame, error) {
+	handle.framer.LinkLayerCRC = handle.LinkLayerCRC
+	handle.framer.Profile = handle.Profile
+	return handle.framer.ReadFrame()
+}
+
+// Receive a single wired frame, the serial ReadTimeout is used as the response timeout
+func (handle *MbusRFC2217Handle) ReceiveWiredFrame() (*MBusFrame, error) {
+	if handle.config.ReadTimeout <= 0 {
+		return nil, ErrNoResponseTimeout
+	}
+
+	return receiveWiredFrame(handle.wiredFramer)
+}
+
+// Discard the bytes which are still arriving, e.g. the tail of a late answer
+func (handle *MbusRFC2217Handle) flushInput() error {
+	handle.framer.Reset()
+	handle.wiredFramer.Reset()
+	return discardInput(handle.read)
+}
+
+// Read the data from the serial port, without the telnet commands.
+// Like a serial port an expired ReadTimeout results in 0 bytes read.
+func (handle *MbusRFC2217Handle) read(buffer []byte) (int, error) {
+	for len(handle.pending) == 0 {
+		deadline := time.Time{}
+		if handle.config.ReadTimeout > 0 {
+			deadline = time.Now().Add(handle.config.ReadTimeout)
+		}
+
+		if err := handle.Fd.SetReadDeadline(deadline); err != nil {
+			return 0, err
+		}
+
+		nread, err := handle.Fd.Read(handle.scratch)
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return 0, nil
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		handle.pending = append(handle.pending, handle.decode(handle.scratch[:nread])...)
+	}
+
+	nread := copy(buffer, handle.pending)
+	handle.pending = handle.pending[nread:]
+
+	return nread, nil
+}
+
+// Decode the received bytes, the telnet commands are handled and the serial data is returned
+func (handle *MbusRFC2217Handle) decode(received []byte) []byte {
+	var data []byte
+
+	for _, b := range received {
+		switch handle.state {
+		case telnetStateData:
+			if b == TELNET_IAC {
+				handle.state = telnetStateIAC
+			} else {
+				data = append(data, b)
+			}
+			break
+		case telnetStateIAC:
+			switch b {
+			case TELNET_IAC:
+				// Escaped 0xFF data byte
+				data = append(data, b)
+				handle.state = telnetStateData
+				break
+			case TELNET_DO, TELNET_DONT, TELNET_WILL, TELNET_WONT:
+				handle.command = b
+				handle.state = telnetStateOption
+				break
+			case TELNET_SB:
+				handle.sbData = nil
+				handle.state = telnetStateSB
+				break
+			default:
+				// Commands without an option (NOP, GA, ...) are ignored
+				handle.state = telnetStateData
+				break
+			}
+			break
+		case telnetStateOption:
+			handle.option(handle.command, b)
+			handle.state = telnetStateData
+			break
+		case telnetStateSB:
+			if b == TELNET_IAC {
+				handle.state = telnetStateSBIAC
+			} else {
+				handle.sbData = append(handle.sbData, b)
+			}
+			break
+		case telnetStateSBIAC:
+			if b == TELNET_SE {
+				handle.subnegotiation(handle.sbData)
+				handle.state = telnetStateData
+			} else {
+				handle.sbData = append(handle.sbData, b)
+				handle.state = telnetStateSB
+			}
+			break
+		}
+	}
+
+	return data
+}
+
+// Handle the option negotiation of the server, the options requested in negotiate are not answered again
+func (handle *MbusRFC2217Handle) option(command byte, option byte) {
+	var reply byte
+
+	switch command {
+	case TELNET_DO:
+		if option == TELNET_OPTION_COM_PORT || option == TELNET_OPTION_BINARY {
+			return
+		}
+		reply = TELNET_WONT
+		break
+	case TELNET_WILL:
+		if option == TELNET_OPTION_BINARY || option == TELNET_OPTION_SGA {
+			return
+		}
+		reply = TELNET_DONT
+		break
+	case TELNET_DONT, TELNET_WONT:
+		if option == TELNET_OPTION_COM_PORT && command == TELNET_DONT {
+			handle.refused = true
+		}
+		return
+	}
+
+	if _, err := handle.Fd.Write([]byte{TELNET_IAC, reply, option}); err != nil && DEBUG {
+		fmt.Printf("Failed to answer telnet option %d: %s\n", option, err)
+	}
+}
+
+func (handle *MbusRFC2217Handle) subnegotiation(data []byte) {
+	if len(data) < 2 || data[0] != TELNET_OPTION_COM_PORT {
+		return
+	}
+
+	handle.responses[data[1]] = data[2:]
+}
+
+// Double the 0xFF bytes, so they are not interpreted as telnet commands
+func escapeTelnet(data []byte) []byte {
+	escaped := make([]byte, 0, len(data))
+
+	for _, b := range data {
+		escaped = append(escaped, b)
+		if b == TELNET_IAC {
+			escaped = append(escaped, TELNET_IAC)
+		}
+	}
+
+	return escaped
+}
@@ -0,0 +1,204 @@
+package mbus
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// A device server which acknowledges the COM port settings and answers every request with the response
+type testDeviceServer struct {
+	listener net.Listener
+	response []byte
+
+	// The highest baud rate the device server applies, a higher request is answered with it
+	maxBaud int
+
+	settings chan [2]int
+}
+
+func newTestDeviceServer(t *testing.T, response []byte) *testDeviceServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &testDeviceServer{
+		listener: listener,
+		response: response,
+		settings: make(chan [2]int, 32),
+	}
+	go server.serve()
+
+	return server
+}
+
+func (server *testDeviceServer) serve() {
+	conn, err := server.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	buffer := make([]byte, PACKET_BUFF_SIZE)
+	var data, sb []byte
+	state := telnetStateData
+
+	for {
+		nread, err := conn.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		for _, b := range buffer[:nread] {
+			switch state {
+			case telnetStateData:
+				if b == TELNET_IAC {
+					state = telnetStateIAC
+				} else {
+					data = append(data, b)
+				}
+			case telnetStateIAC:
+				switch b {
+				case TELNET_IAC:
+					data = append(data, b)
+					state = telnetStateData
+				case TELNET_SB:
+					sb = nil
+					state = telnetStateSB
+				default:
+					state = telnetStateOption
+				}
+			case telnetStateOption:
+				if b == TELNET_OPTION_COM_PORT {
+					conn.Write([]byte{TELNET_IAC, TELNET_DO, TELNET_OPTION_COM_PORT})
+				}
+				state = telnetStateData
+			case telnetStateSB:
+				if b == TELNET_IAC {
+					state = telnetStateSBIAC
+				} else {
+					sb = append(sb, b)
+				}
+			case telnetStateSBIAC:
+				if b != TELNET_SE {
+					sb = append(sb, b)
+					state = telnetStateSB
+					continue
+				}
+
+				value := int(sb[2])
+				if sb[1] == RFC2217_SET_BAUDRATE {
+					value = int(binary.BigEndian.Uint32(sb[2:6]))
+				}
+				server.settings <- [2]int{int(sb[1]), value}
+
+				applied := sb[2:]
+				if sb[1] == RFC2217_SET_BAUDRATE && server.maxBaud > 0 && value > server.maxBaud {
+					applied = make([]byte, 4)
+					binary.BigEndian.PutUint32(applied, uint32(server.maxBaud))
+				}
+
+				reply := append([]byte{TELNET_IAC, TELNET_SB, TELNET_OPTION_COM_PORT, sb[1] + RFC2217_SERVER_OFFSET}, escapeTelnet(applied)...)
+				conn.Write(append(reply, TELNET_IAC, TELNET_SE))
+				state = telnetStateData
+			}
+		}
+
+		// Answer a complete request
+		frame := NewWiredMBusFrame()
+		if result, err := ParseWiredMBusData(frame, &data, len(data)); err == nil && result.GotFrame && result.Remaining == 0 {
+			data = nil
+			conn.Write(escapeTelnet(server.response))
+		}
+	}
+}
+
+func TestRFC2217Client(t *testing.T) {
+	// The counter value contains a 0xFF byte, which has to be escaped by the device server
+	response := &MBusFrame{
+		Type:               FRAME_TYPE_LONG,
+		Control:            CONTROL_MASK_RSP_UD,
+		Address:            0x05,
+		ControlInformation: CONTROL_INFO_RESP_VARIABLE,
+		Data: []byte{
+			0x78, 0x56, 0x34, 0x12, 0x2D, 0x2C, 0x01, 0x04, 0x2A, 0x00, 0x00, 0x00,
+			0x04, 0x06, 0xFF, 0x00, 0x00, 0x00,
+		},
+		DataSize: 18,
+	}
+	encoded, _ := response.Encode()
+
+	server := newTestDeviceServer(t, encoded)
+
+	handle, err := NewRFC2217Client(server.listener.Addr().String(), SerialConfig{
+		Baud:        2400,
+		Parity:      'E',
+		ReadTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	expected := [][2]int{
+		{RFC2217_SET_BAUDRATE, 2400},
+		{RFC2217_SET_DATASIZE, 8},
+		{RFC2217_SET_PARITY, 3},
+		{RFC2217_SET_STOPSIZE, 1},
+		{RFC2217_SET_CONTROL, RFC2217_CONTROL_NO_FLOW_CONTROL},
+	}
+	for _, setting := range expected {
+		if received := <-server.settings; received != setting {
+			t.Fatalf("expected COM port setting %v, got: %v", setting, received)
+		}
+	}
+
+	client := handle.(*MbusRFC2217Handle)
+
+	decoded, err := client.Readout(context.Background(), 0x05, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.DataRecords) != 1 || decoded.DataRecords[0].Value != "255" {
+		t.Fatalf("unexpected data records: %+v", decoded.DataRecords)
+	}
+
+	if err := client.SetLocalBaudRate(300); err != nil {
+		t.Fatal(err)
+	}
+
+	if received := <-server.settings; received != [2]int{RFC2217_SET_BAUDRATE, 300} || client.BaudRate() != 300 {
+		t.Fatalf("expected the baud rate to be set to 300, got: %v", received)
+	}
+
+	// The slave answers slower at 300 baud, the read timeout is raised to its response timeout
+	if client.config.ReadTimeout != 1200*time.Millisecond {
+		t.Fatalf("expected a read timeout of 1.2s at 300 baud, got: %s", client.config.ReadTimeout)
+	}
+
+	if err := client.SetLocalBaudRate(2400); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.config.ReadTimeout != time.Second {
+		t.Fatalf("expected the read timeout of 1s to be restored, got: %s", client.config.ReadTimeout)
+	}
+}
+
+func TestRFC2217ClientRefusedSetting(t *testing.T) {
+	server := newTestDeviceServer(t, nil)
+	server.maxBaud = 9600
+
+	_, err := NewRFC2217Client(server.listener.Addr().String(), SerialConfig{
+		Baud:        38400,
+		ReadTimeout: time.Second,
+	})
+	if err == nil {
+		t.Fatal("expected an error for a baud rate which the device server does not apply")
+	}
+}
@@ -0,0 +1,138 @@
+package mbus
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Secondary address of a slave, used to select it on a bus where the primary addresses are not unique.
+// An 0xF nibble in the Id, 0xFFFF as Manufacturer and 0xFF as Version or DeviceType are wildcards.
+type SecondaryAddress struct {
+	// BCD, LSB first
+	Id [4]byte
+
+	// LSB first
+	Manufacturer [2]byte
+
+	Version    byte
+	DeviceType byte
+}
+
+// The secondary address which matches every slave
+var SecondaryAddressWildcard = SecondaryAddress{
+	Id:           [4]byte{0xFF, 0xFF, 0xFF, 0xFF},
+	Manufacturer: [2]byte{0xFF, 0xFF},
+	Version:      0xFF,
+	DeviceType:   0xFF,
+}
+
+// Parse the 16 hexadecimal characters form of a secondary address:
+// 8 digits Id, 4 characters Manufacturer, 2 characters Version and 2 characters DeviceType (medium).
+// E.g. 12345678 2C2D 01 04 for the meter with Id 12345678 from KAM, or FFFFFFFFFFFFFFFF to match every meter.
+func ParseSecondaryAddress(address string) (SecondaryAddress, error) {
+	var secondaryAddress SecondaryAddress
+
+	if len(address) != 16 {
+		return secondaryAddress, fmt.Errorf("secondary address must be 16 characters long, got: %d", len(address))
+	}
+
+	data, err := hex.DecodeString(address)
+	if err != nil {
+		return secondaryAddress, fmt.Errorf("invalid secondary address '%s': %s", address, err)
+	}
+
+	// The Id only allows decimal digits or the 0xF wildcard
+	for i := 0; i < 8; i++ {
+		if c := strings.ToUpper(address)[i]; c > '9' && c != 'F' {
+			return secondaryAddress, fmt.Errorf("invalid secondary address '%s': id digit %d is not a decimal or wildcard", address, i)
+		}
+	}
+
+	// The string holds the values MSB first
+	secondaryAddress.Id = [4]byte{data[3], data[2], data[1], data[0]}
+	secondaryAddress.Manufacturer = [2]byte{data[5], data[4]}
+	secondaryAddress.Version = data[6]
+	secondaryAddress.DeviceType = data[7]
+
+	return secondaryAddress, nil
+}
+
+func (address SecondaryAddress) String() string {
+	return fmt.Sprintf(
+		"%.2X%.2X%.2X%.2X%.2X%.2X%.2X%.2X",
+		address.Id[3], address.Id[2], address.Id[1], address.Id[0],
+		address.Manufacturer[1], address.Manufacturer[0],
+		address.Version,
+		address.DeviceType,
+	)
+}
+
+// The secondary address as it is send in the data of a selection frame
+func (address SecondaryAddress) Bytes() []byte {
+	return []byte{
+		address.Id[0], address.Id[1], address.Id[2], address.Id[3],
+		address.Manufacturer[0], address.Manufacturer[1],
+		address.Version,
+		address.DeviceType,
+	}
+}
+
+// Returns the digit of the Id at the given position, position 0 is the most significant digit
+func (address SecondaryAddress) IdDigit(position int) byte {
+	b := address.Id[3-position/2]
+
+	if position%2 == 0 {
+		return b >> 4
+	}
+
+	return b & 0x0F
+}
+
+// Returns a copy of the address with the digit of the Id at the given position replaced
+func (address SecondaryAddress) WithIdDigit(position int, digit byte) SecondaryAddress {
+	i := 3 - position/2
+
+	if position%2 == 0 {
+		address.Id[i] = address.Id[i]&0x0F | digit<<4
+	} else {
+		address.Id[i] = address.Id[i]&0xF0 | digit&0x0F
+	}
+
+	return address
+}
+
+// Check if the address matches the given mask, which may contain wildcards
+func (address SecondaryAddress) Matches(mask SecondaryAddress) bool {
+	for position := 0; position < 8; position++ {
+		if digit := mask.IdDigit(position); digit != 0x0F && digit != address.IdDigit(position) {
+			return false
+		}
+	}
+
+	if mask.Manufacturer != [2]byte{0xFF, 0xFF} && mask.Manufacturer != address.Manufacturer {
+		return false
+	}
+
+	if mask.Version != 0xFF && mask.Version != address.Version {
+		return false
+	}
+
+	return mask.DeviceType == 0xFF || mask.DeviceType == address.DeviceType
+}
+
+// The secondary address of the slave which send this variable data structure response
+func (frame *MBusFrame) SecondaryAddress() (SecondaryAddress, error) {
+	var address SecondaryAddress
+
+	if len(frame.Header.Id) != 4 || len(frame.Header.Manufacturer) != 2 {
+		return address, fmt.Errorf("frame has no fixed data header")
+	}
+
+	copy(address.Id[:], frame.Header.Id)
+	copy(address.Manufacturer[:], frame.Header.Manufacturer)
+	address.Version = frame.Header.Version
+	address.DeviceType = frame.Header.DeviceType
+
+	return address, nil
+}
@@ -2,7 +2,10 @@ package mbus
 
 import (
     "context"
+    "errors"
     "fmt"
+    "io"
+    "time"
     "github.com/tarm/serial"
 )
 
@@ -11,6 +14,17 @@ type SerialConfig serial.Config
 type MbusSerialHandle struct {
     MbusHandle
     Fd *serial.Port
+
+    // Kept to reopen the port at another baud rate
+    device string
+    config SerialConfig
+    // The ReadTimeout before SetLocalBaudRate raised it for a slower baud rate
+    readTimeout time.Duration
+
+    reader *serialReader
+    // Framers for the wireless frames and for the answers of the wired slaves
+    framer *Framer
+    wiredFramer *Framer
 }
 
 func NewSerialClient(device string, config SerialConfig) (Handle, error) {
@@ -22,6 +36,7 @@ func NewSerialClient(device string, config SerialConfig) (Handle, error) {
             IsSerial: true,
         },
     }
+    client.wired = client
 
     if err := client.Open(device, config); err != nil {
         return nil, err
@@ -39,39 +54,67 @@ func (handle *MbusSerialHandle) Open(device string, config interface{}) error {
        Size: serialConfig.Size,
        StopBits: serialConfig.StopBits,
        Parity: serialConfig.Parity,
-       ReadTimeout: serialConfig.ReadTimeout,
+       ReadTimeout: serialReadTimeout(serialConfig.ReadTimeout),
     })
     if err != nil {
         return err
     }
 
     handle.Fd = port
+    handle.reader = &serialReader{port: port}
+    handle.framer = NewWirelessFramer(readFunc(handle.read))
+    handle.wiredFramer = NewWiredFramer(readFunc(handle.read))
+    handle.device = device
+    handle.config = serialConfig
+    handle.readTimeout = serialConfig.ReadTimeout
     return nil
 }
 
-func (handle *MbusSerialHandle) Stream(ctx context.Context) chan Frame {
-    stream := make(chan Frame, 1024)
-
-    go func() {
-        for {
-            select {
-            case <-ctx.Done():
-                close(stream)
-                return
-            default:
-                frame, err := handle.ReceiveFrame()
-                if err != nil {
-                    fmt.Printf("Got error while receiving frame: %s\n", err)
-                } else {
-                    stream<-frame
-                }
-            }
-        }
-    }()
+// The serial port truncates the read timeout to tenths of a second, e.g. the ResponseTimeout of 187ms at 2400 baud
+// would become 100ms. The timeout is rounded up instead, so the port waits at least as long as requested.
+func serialReadTimeout(timeout time.Duration) time.Duration {
+    if timeout <= 0 {
+        return timeout
+    }
+
+    tenth := 100 * time.Millisecond
+    return (timeout + tenth - 1) / tenth * tenth
+}
+
+func (handle *MbusSerialHandle) BaudRate() int {
+    return handle.config.Baud
+}
+
+// Reopen the serial port at the given baud rate, the other settings of the port are kept.
+// The read timeout is raised to the response timeout of the baud rate, see baudReadTimeout.
+func (handle *MbusSerialHandle) SetLocalBaudRate(baud int) error {
+    if err := handle.Close(); err != nil {
+        return err
+    }
+
+    readTimeout := handle.readTimeout
+
+    config := handle.config
+    config.Baud = baud
+    config.ReadTimeout = baudReadTimeout(readTimeout, baud)
 
+    if err := handle.Open(handle.device, config); err != nil {
+        return err
+    }
+
+    handle.readTimeout = readTimeout
+    return nil
+}
+
+func (handle *MbusSerialHandle) Stream(ctx context.Context) chan Frame {
+    stream, _ := handle.StreamWithErrors(ctx)
     return stream
 }
 
+func (handle *MbusSerialHandle) StreamWithErrors(ctx context.Context) (chan Frame, chan error) {
+    return streamFrames(ctx, handle.ReceiveFrame)
+}
+
 func (handle *MbusSerialHandle) Close() error {
     if err := handle.Fd.Close(); err != nil {
         return err
@@ -81,82 +124,106 @@ func (handle *MbusSerialHandle) Close() error {
 }
 
 func (handle *MbusSerialHandle) Send(frame Frame) error {
-    //data, _ := frame.Encode()
-    //handle.Fd.Write(data)
-    return nil
-}
+    data, length := encodeFrame(frame)
+    if length == 0 {
+        return fmt.Errorf("unable to encode frame")
+    }
 
-func (handle *MbusSerialHandle) ReceiveFrame() (Frame, error) {
-    buffer := make([]byte, PACKET_BUFF_SIZE)
-    frame := NewWirelessMBusFrame()
+    if DEBUG {
+        fmt.Printf("Sending frame [size = %d]\n", length)
+
+        for i := 0; i < length; i++ {
+            fmt.Printf("%.2X ", data[i])
+        }
+        fmt.Println()
+    }
 
-    // Clear the buffer for the GC
-    defer func() {
-        buffer = nil
-    }()
+    return handle.WriteRaw(data[:length])
+}
 
-    length := 0
-    remaining := 1
-    timeouts := 0
+// Write the bytes as is, e.g. to configure the dongle
+func (handle *MbusSerialHandle) WriteRaw(data []byte) error {
+    written, err := handle.Fd.Write(data)
+    if err != nil {
+        return err
+    }
 
-    for {
-        if length + remaining > PACKET_BUFF_SIZE {
-            return nil, fmt.Errorf("out of bounds")
+    if written != len(data) {
+        return &ShortWriteError{
+            Written: written,
+            Expected: len(data),
         }
+    }
 
-        // Since Fd.Read() will read all bytes until the given buffer is full..
-        // we use the tmpBuffer to force Fd.Read() to only retrieve len(tmpBuffer) amount bytes
-        // tmpBuffer is a dynamic sized buffer on each loop
-        // This way we can check each byte on its own, and only start collecting data when there is a frame start byte.
+    return nil
+}
 
-        // We could resize the buffer (buffer = buffer[:remaining] to fix this issue,
-        // but then every loop the buffer would be overwritten from index 0,
-        // since Fd.Read() will write into the buffer from the start (index 0).
-        tmpBuffer := make([]byte, remaining)
+// Read the received bytes as is, the bytes buffered for the next frame are discarded
+func (handle *MbusSerialHandle) ReadRaw(buffer []byte) (int, error) {
+    handle.framer.Reset()
+    handle.wiredFramer.Reset()
+    return handle.read(buffer)
+}
 
-        if DEBUG {
-            fmt.Println("Waiting for data from serial device...")
-        }
-        nread, err := handle.Fd.Read(tmpBuffer)
-        if err != nil {
-            return nil, err
-        }
+// Receive the next wireless frame, the bytes after it are buffered for the next call
+func (handle *MbusSerialHandle) ReceiveFrame() (Frame, error) {
+    handle.framer.LinkLayerCRC = handle.LinkLayerCRC
+    handle.framer.Profile = handle.Profile
+    return handle.framer.ReadFrame()
+}
 
-        if nread == 0 {
-            timeouts++
+// Receive a single wired frame, the serial ReadTimeout is used as the response timeout
+func (handle *MbusSerialHandle) ReceiveWiredFrame() (*MBusFrame, error) {
+    if handle.config.ReadTimeout <= 0 {
+        return nil, ErrNoResponseTimeout
+    }
 
-            if timeouts >= 3 {
-                return nil, fmt.Errorf("timeout")
-            }
+    return receiveWiredFrame(handle.wiredFramer)
+}
 
-            // Nothing else to do here
-            continue
-        }
+// Discard the bytes which are still arriving, e.g. the tail of a late answer
+func (handle *MbusSerialHandle) flushInput() error {
+    handle.framer.Reset()
+    handle.wiredFramer.Reset()
+    return discardInput(handle.read)
+}
 
-        // Copy over the data from the temporary remaining buffer to the actual buffer for the M-Bus frame
-        for i := 0; i < len(tmpBuffer); i++ {
-            buffer[length + i] = tmpBuffer[i]
-        }
+func (handle *MbusSerialHandle) read(buffer []byte) (int, error) {
+    return handle.reader.Read(buffer)
+}
 
-        // Clear the temporary buffer
-        tmpBuffer = nil
+// Empty reads which return faster than this are not an expired read timeout, which is at least 100ms
+const serialHangupTime = 50 * time.Millisecond
+// Number of immediate empty reads in a row after which the port is gone
+const serialHangupReads = 3
 
-        length += nread
+// The port reports both an expired read timeout and a hangup (e.g. an unplugged USB adapter) as 0 bytes and io.EOF.
+// An expired read timeout is 0 bytes without an error for the receive loops, but after a hangup every read returns
+// immediately, which is reported as ErrDisconnected.
+type serialReader struct {
+    port io.Reader
 
-        parseResult, err := ParseWirelessMBusData(frame, &buffer, length)
-        if err != nil {
-            return nil, err
-        }
+    // Number of immediate empty reads in a row
+    immediate int
+}
 
-        remaining = parseResult.Remaining
+func (reader *serialReader) Read(buffer []byte) (int, error) {
+    start := time.Now()
 
-        // We got some useless bytes
-        if !parseResult.GotFrame {
-            length -= nread
-        }
+    nread, err := reader.port.Read(buffer)
+    if nread > 0 || (err != nil && !errors.Is(err, io.EOF)) {
+        reader.immediate = 0
+        return nread, err
+    }
 
-        if remaining == 0 {
-            return frame, nil
-        }
+    if time.Since(start) >= serialHangupTime {
+        reader.immediate = 0
+        return 0, nil
     }
+
+    if reader.immediate++; reader.immediate >= serialHangupReads {
+        return 0, ErrDisconnected
+    }
+
+    return 0, nil
 }
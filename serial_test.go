@@ -0,0 +1,97 @@
+package mbus
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// Behaves like the serial port on Linux, which returns 0 bytes and io.EOF when the read timeout expires,
+// and immediately after a hangup
+type serialPortReader struct {
+	chunks  [][]byte
+	timeout time.Duration
+}
+
+func (port *serialPortReader) Read(buffer []byte) (int, error) {
+	if len(port.chunks) == 0 {
+		time.Sleep(port.timeout)
+		return 0, io.EOF
+	}
+
+	n := copy(buffer, port.chunks[0])
+	if n < len(port.chunks[0]) {
+		port.chunks[0] = port.chunks[0][n:]
+	} else {
+		port.chunks = port.chunks[1:]
+	}
+
+	return n, nil
+}
+
+func TestSerialReadTimeout(t *testing.T) {
+	port := &serialPortReader{chunks: [][]byte{testWiredFrame}, timeout: 100 * time.Millisecond}
+	framer := NewWiredFramer(&serialReader{port: port})
+
+	frame, err := receiveWiredFrame(framer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if frame.Type != FRAME_TYPE_LONG {
+		t.Fatalf("expected a long frame, got frame type %d", frame.Type)
+	}
+
+	// A slave which does not answer is a timeout, which the transactions retry
+	if _, err := receiveWiredFrame(framer); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+
+	// A slave which stops answering half way as well
+	port.chunks = [][]byte{testWiredFrame[:10]}
+	if _, err := receiveWiredFrame(framer); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+
+	// The data of a truncated answer is dropped, the 0xE5 in it is not an ACK
+	port.chunks = [][]byte{{FRAME_LONG_START, 0x0A, 0x0A, FRAME_LONG_START, 0x08, 0x05, 0x72, FRAME_ACK_START}}
+	if _, err := receiveWiredFrame(framer); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+}
+
+func TestSerialHangup(t *testing.T) {
+	port := &serialPortReader{chunks: [][]byte{testWiredFrame}}
+	reader := &serialReader{port: port}
+	framer := NewWiredFramer(reader)
+
+	if _, err := receiveWiredFrame(framer); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first immediate empty reads can not be told apart from a timeout
+	for i := 1; i < serialHangupReads; i++ {
+		if nread, err := reader.Read(make([]byte, 1)); nread != 0 || err != nil {
+			t.Fatalf("read %d: expected a timeout, got: %d %v", i, nread, err)
+		}
+	}
+
+	if _, err := receiveWiredFrame(framer); !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("expected ErrDisconnected, got: %v", err)
+	}
+
+	// The port is gone, the stream ends with the error
+	stream, errs := streamFrames(context.Background(), func() (Frame, error) {
+		return receiveWiredFrame(framer)
+	})
+
+	for range stream {
+		t.Fatalf("expected no frames")
+	}
+
+	if err := <-errs; !errors.Is(err, ErrDisconnected) {
+		t.Fatalf("expected ErrDisconnected, got: %v", err)
+	}
+}
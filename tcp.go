@@ -0,0 +1,184 @@
+package mbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+type TCPConfig struct {
+	// Maximum time to wait for the connection to be established, 0 means no timeout
+	ConnectTimeout time.Duration
+	// Maximum time to wait for data, 0 means no timeout. Use ResponseTimeout for wired M-Bus gateways.
+	ReadTimeout time.Duration
+	// Interval of the TCP keepalive probes, 0 enables keepalive with the default interval, a negative value disables it
+	KeepAlive time.Duration
+}
+
+// Handle for gateways which expose the M-Bus or a wM-Bus receiver as a raw TCP socket
+type MbusTCPHandle struct {
+	MbusHandle
+	Fd net.Conn
+
+	config TCPConfig
+
+	// Framers for the wireless frames and for the answers of the wired slaves
+	framer      *Framer
+	wiredFramer *Framer
+}
+
+func NewTCPClient(address string, config TCPConfig) (Handle, error) {
+	client, err := newTCPClient(context.Background(), address, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func newTCPClient(ctx context.Context, address string, config TCPConfig) (*MbusTCPHandle, error) {
+	client := &MbusTCPHandle{
+		Fd: nil,
+		MbusHandle: MbusHandle{
+			MaxDataRetry:   3,
+			MaxSearchRetry: 3,
+		},
+	}
+	client.wired = client
+
+	if err := client.open(ctx, address, config); err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (handle *MbusTCPHandle) Open(address string, config interface{}) error {
+	tcpConfig, ok := config.(TCPConfig)
+	if !ok {
+		return fmt.Errorf("expected a TCPConfig, got: %T", config)
+	}
+
+	return handle.open(context.Background(), address, tcpConfig)
+}
+
+func (handle *MbusTCPHandle) open(ctx context.Context, address string, tcpConfig TCPConfig) error {
+	dialer := net.Dialer{
+		Timeout:   tcpConfig.ConnectTimeout,
+		KeepAlive: tcpConfig.KeepAlive,
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+
+	handle.Fd = conn
+	handle.framer = NewWirelessFramer(readFunc(handle.read))
+	handle.wiredFramer = NewWiredFramer(readFunc(handle.read))
+	handle.config = tcpConfig
+	return nil
+}
+
+func (handle *MbusTCPHandle) Stream(ctx context.Context) chan Frame {
+	stream, _ := handle.StreamWithErrors(ctx)
+	return stream
+}
+
+// The channels are closed when the gateway closes the connection
+func (handle *MbusTCPHandle) StreamWithErrors(ctx context.Context) (chan Frame, chan error) {
+	return streamFrames(ctx, handle.ReceiveFrame)
+}
+
+func (handle *MbusTCPHandle) Close() error {
+	if err := handle.Fd.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (handle *MbusTCPHandle) Send(frame Frame) error {
+	data, length := encodeFrame(frame)
+	if length == 0 {
+		return fmt.Errorf("unable to encode frame")
+	}
+
+	if DEBUG {
+		fmt.Printf("Sending frame [size = %d]\n", length)
+
+		for i := 0; i < length; i++ {
+			fmt.Printf("%.2X ", data[i])
+		}
+		fmt.Println()
+	}
+
+	return handle.WriteRaw(data[:length])
+}
+
+// Write the bytes as is, e.g. to configure the dongle
+func (handle *MbusTCPHandle) WriteRaw(data []byte) error {
+	written, err := handle.Fd.Write(data)
+	if err != nil {
+		return err
+	}
+
+	if written != len(data) {
+		return &ShortWriteError{
+			Written:  written,
+			Expected: len(data),
+		}
+	}
+
+	return nil
+}
+
+// Read the received bytes as is, the bytes buffered for the next frame are discarded
+func (handle *MbusTCPHandle) ReadRaw(buffer []byte) (int, error) {
+	handle.framer.Reset()
+	handle.wiredFramer.Reset()
+	return handle.read(buffer)
+}
+
+// Receive the next wireless frame, the bytes after it are buffered for the next call
+func (handle *MbusTCPHandle) ReceiveFrame() (Frame, error) {
+	handle.framer.LinkLayerCRC = handle.LinkLayerCRC
+	handle.framer.Profile = handle.Profile
+	return handle.framer.ReadFrame()
+}
+
+// Receive a single wired frame, the ReadTimeout is used as the response timeout
+func (handle *MbusTCPHandle) ReceiveWiredFrame() (*MBusFrame, error) {
+	if handle.config.ReadTimeout <= 0 {
+		return nil, ErrNoResponseTimeout
+	}
+
+	return receiveWiredFrame(handle.wiredFramer)
+}
+
+// Discard the bytes which are still arriving, e.g. the tail of a late answer
+func (handle *MbusTCPHandle) flushInput() error {
+	handle.framer.Reset()
+	handle.wiredFramer.Reset()
+	return discardInput(handle.read)
+}
+
+// Read with the ReadTimeout as deadline, like a serial port an expired deadline results in 0 bytes read
+func (handle *MbusTCPHandle) read(buffer []byte) (int, error) {
+	if handle.config.ReadTimeout > 0 {
+		if err := handle.Fd.SetReadDeadline(time.Now().Add(handle.config.ReadTimeout)); err != nil {
+			return 0, err
+		}
+	}
+
+	nread, err := handle.Fd.Read(buffer)
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nread, nil
+	}
+
+	return nread, err
+}
@@ -0,0 +1,143 @@
+package mbus
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// Start a gateway which answers each request with the given responses, in order
+func newTestGateway(t *testing.T, responses ...[]byte) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for _, response := range responses {
+			request := make([]byte, PACKET_BUFF_SIZE)
+			if _, err := conn.Read(request); err != nil {
+				return
+			}
+
+			if _, err := conn.Write(response); err != nil {
+				return
+			}
+		}
+
+		// Keep the connection open until the client closes it
+		conn.Read(make([]byte, 1))
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestTCPClient(t *testing.T) {
+	// The second request is not answered
+	address := newTestGateway(t, testWiredFrame, []byte{})
+
+	handle, err := NewTCPClient(address, TCPConfig{
+		ConnectTimeout: time.Second,
+		ReadTimeout:    ResponseTimeout(2400),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	client := handle.(*MbusTCPHandle)
+	client.MaxDataRetry = 0
+
+	frame, err := client.RequestData(context.Background(), 0x05)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := frame.DataParse(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.RequestData(context.Background(), 0x05); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+}
+
+func TestTCPClientFlush(t *testing.T) {
+	// The first answer is corrupted and followed by the ACK of a second slave
+	corrupted := append([]byte(nil), testWiredFrame...)
+	corrupted[len(corrupted)-2] ^= 0xFF
+	address := newTestGateway(t, append(corrupted, FRAME_ACK_START), testWiredFrame)
+
+	handle, err := NewTCPClient(address, TCPConfig{
+		ConnectTimeout: time.Second,
+		ReadTimeout:    ResponseTimeout(2400),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	client := handle.(*MbusTCPHandle)
+	client.MaxDataRetry = 1
+
+	// The ACK is discarded before the request is repeated, instead of being read as its answer
+	if _, err := client.RequestData(context.Background(), 0x05); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTCPClientNoReadTimeout(t *testing.T) {
+	address := newTestGateway(t, []byte{})
+
+	handle, err := NewTCPClient(address, TCPConfig{ConnectTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	if _, err := handle.(*MbusTCPHandle).RequestData(context.Background(), 0x05); !errors.Is(err, ErrNoResponseTimeout) {
+		t.Fatalf("expected ErrNoResponseTimeout, got: %v", err)
+	}
+}
+
+func TestTCPClientStream(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		conn.Write(testFrame)
+		conn.Close()
+	}()
+
+	handle, err := NewTCPClient(listener.Addr().String(), TCPConfig{ConnectTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	var frames []Frame
+	for frame := range handle.Stream(context.Background()) {
+		frames = append(frames, frame)
+	}
+
+	if len(frames) != 1 {
+		t.Fatalf("expected 1 frame before the connection was closed, got: %d", len(frames))
+	}
+}
@@ -6,8 +6,8 @@ type TelegramACK WMBusFrame
 
 func NewTelegramACK() *TelegramACK {
 	frame := &TelegramACK{
-		Start: FRAME_LONG_START,
-		Stop: FRAME_STOP,
+		Start: FRAME_ACK_START,
+		Type:  FRAME_TYPE_ACK,
 	}
 
 	return frame
@@ -38,6 +38,9 @@ func (f *TelegramACK) Verify() error {
 	return nil
 }
 
+// An ACK only exists of its start byte
 func (f *TelegramACK) Encode() ([]byte, int) {
-	return []byte{}, 0
+	f.Start = FRAME_ACK_START
+
+	return []byte{f.Start}, 1
 }
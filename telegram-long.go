@@ -10,6 +10,11 @@ func NewTelegramLong() *TelegramLong {
 	frame := &TelegramLong{
 		Start: FRAME_LONG_START,
 		Stop:  FRAME_STOP,
+		Type:  FRAME_TYPE_LONG,
+		Header: WMBusHeader{
+			Manufacturer: make([]byte, 2),
+			Id:           make([]byte, 4),
+		},
 	}
 
 	return frame
@@ -77,7 +82,7 @@ func (f *TelegramLong) VerifyControl() error {
 		f.Control != (CONTROL_MASK_RSP_UD|CONTROL_MASK_DFC) &&
 		f.Control != (CONTROL_MASK_RSP_UD|CONTROL_MASK_ACD) &&
 		f.Control != (CONTROL_MASK_RSP_UD|CONTROL_MASK_DFC|CONTROL_MASK_ACD) {
-		return fmt.Errorf("unkown Control Code 0x%.2x", f.Control)
+		return fmt.Errorf("%w: unknown control code 0x%.2x", ErrUnsupported, f.Control)
 	}
 
 	return nil
@@ -110,31 +115,39 @@ func (f *TelegramLong) Verify() error {
 	return nil
 }
 
+// Encode the frame in the same layout as it is read by ParseWirelessMBusData
 func (f *TelegramLong) Encode() ([]byte, int) {
+	f.Length = byte(f.CalculateLength())
+	f.Checksum = f.CalculateChecksum()
+
 	pack := []byte{
 		f.Start,
 		f.Length,
 		f.Control,
+		f.Header.Manufacturer[0],
+		f.Header.Manufacturer[1],
 		f.Header.Id[0],
 		f.Header.Id[1],
 		f.Header.Id[2],
 		f.Header.Id[3],
+		f.Header.Version,
+		f.Header.DeviceType,
 		f.ControlInformation,
+		f.Header.AccessNumber,
+		f.Header.Status,
+		byte(f.Header.NEncryptedBlocks),
+		f.Header.EncryptionMode,
 	}
 
-	// Total pack size
-	offset := 7
+	pack = append(pack, f.Data[:f.DataSize]...)
 
-	for i := 0; i < f.DataSize; i++ {
-		pack = append(pack, f.Data[i])
-		offset++
+	// The RSSI and CRC bytes are included in the length but are added by the radio module,
+	// reserve them so the checksum and stop byte end up at the position given by the length
+	for len(pack) < int(f.Length)+1 {
+		pack = append(pack, 0x00)
 	}
 
-	pack = append(pack, f.Checksum)
-	offset++
-
-	pack = append(pack, f.Stop)
-	offset++
+	pack = append(pack, f.Checksum, f.Stop)
 
-	return pack, offset
+	return pack, len(pack)
 }
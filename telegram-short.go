@@ -8,6 +8,11 @@ func NewTelegramShort() *TelegramShort {
 	frame := &TelegramShort{
 		Start: FRAME_SHORT_START,
 		Stop: FRAME_STOP,
+		Type: FRAME_TYPE_SHORT,
+		Header: WMBusHeader{
+			Manufacturer: make([]byte, 2),
+			Id:           make([]byte, 4),
+		},
 	}
 
 	return frame
@@ -38,13 +43,15 @@ func (f *TelegramShort) Verify() error {
 		f.Control != (CONTROL_MASK_REQ_UD1 | CONTROL_MASK_FCB) &&
 		f.Control != CONTROL_MASK_REQ_UD2 &&
 		f.Control != (CONTROL_MASK_REQ_UD2 | CONTROL_MASK_FCB) {
-		return fmt.Errorf("unknown Controle Code 0x%.2x", f.Control)
+		return fmt.Errorf("%w: unknown control code 0x%.2x", ErrUnsupported, f.Control)
 	}
 
 	return nil
 }
 
 func (f *TelegramShort) Encode() ([]byte, int) {
+	f.Checksum = f.CalculateChecksum()
+
 	pack := []byte{
 		f.Start,
 		f.Control,
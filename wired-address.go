@@ -0,0 +1,55 @@
+package mbus
+
+import (
+	"context"
+	"fmt"
+)
+
+// Change the primary address of the slave at the current primary address.
+// The change is verified by polling the slave at its new primary address.
+func (handle *MbusHandle) SetPrimaryAddress(ctx context.Context, current byte, address byte) error {
+	if err := handle.writePrimaryAddress(ctx, current, address); err != nil {
+		return err
+	}
+
+	return handle.verifyPrimaryAddress(ctx, address)
+}
+
+// Select the slave with the given secondary address and change its primary address.
+// The change is verified by polling the slave at its new primary address.
+func (handle *MbusHandle) SetPrimaryAddressSecondary(ctx context.Context, secondaryAddress SecondaryAddress, address byte) error {
+	if err := handle.Select(ctx, secondaryAddress); err != nil {
+		return err
+	}
+
+	if err := handle.writePrimaryAddress(ctx, ADDRESS_NETWORK_LAYER, address); err != nil {
+		return err
+	}
+
+	// Make sure the slave no longer answers at ADDRESS_NETWORK_LAYER
+	if err := handle.Deselect(ctx); err != nil {
+		return err
+	}
+
+	return handle.verifyPrimaryAddress(ctx, address)
+}
+
+// Send the bus address data record (DIF 0x01, VIF 0x7A) to the slave and wait for its ACK. Like the other addressing
+// requests it is repeated up to MaxSearchRetry times.
+func (handle *MbusHandle) writePrimaryAddress(ctx context.Context, current byte, address byte) error {
+	if address > MAX_PRIMARY_SLAVES {
+		return fmt.Errorf("invalid primary address %d, must be between 0 and %d", address, MAX_PRIMARY_SLAVES)
+	}
+
+	return handle.writeDataRecords(ctx, current, CONTROL_INFO_DATA_SEND, []*DataRecord{
+		NewDataRecord(0x01, nil, byte(VIFUnit["ADDRESS"]), nil, []byte{address}),
+	}, handle.MaxSearchRetry)
+}
+
+func (handle *MbusHandle) verifyPrimaryAddress(ctx context.Context, address byte) error {
+	if err := handle.Ping(ctx, address); err != nil {
+		return fmt.Errorf("slave does not answer at its new primary address 0x%.2X: %w", address, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package mbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Implemented by the handles which can discard the received bytes before a request is repeated
+type inputFlusher interface {
+	flushInput() error
+}
+
+// The maximum time a slave may take to answer according to EN 13757-2,
+// which is 330 bit times plus 50ms. It should be used as the ReadTimeout of the connection,
+// the wired transactions need a read timeout to detect a slave which does not answer.
+func ResponseTimeout(baud int) time.Duration {
+	if baud <= 0 {
+		return 0
+	}
+
+	return time.Duration(330*int64(time.Second)/int64(baud)) + 50*time.Millisecond
+}
+
+// The read timeout of a handle switched to the given baud rate: the configured timeout, raised to the ResponseTimeout
+// of the baud rate in whole tenths of a second. Switching back to the original baud rate restores the configured
+// timeout, a configured timeout of 0 is kept.
+func baudReadTimeout(configured time.Duration, baud int) time.Duration {
+	if configured <= 0 {
+		return configured
+	}
+
+	if minimum := serialReadTimeout(ResponseTimeout(baud)); configured < minimum {
+		return minimum
+	}
+
+	return configured
+}
+
+// Send a SND_NKE to the slave at the given primary address and wait for its ACK
+func (handle *MbusHandle) Ping(ctx context.Context, address byte) error {
+	_, err := handle.transaction(ctx, NewSndNkeFrame(address), handle.MaxSearchRetry, verifyAck)
+	return err
+}
+
+// Send a REQ_UD2 to the slave at the given primary address and wait for its RSP_UD.
+// The request is repeated up to MaxDataRetry times when the slave does not answer in time
+// or its answer is invalid.
+func (handle *MbusHandle) RequestData(ctx context.Context, address byte) (*MBusFrame, error) {
+	return handle.requestData(ctx, NewReqUd2Frame(address, false))
+}
+
+// Select the slave with the given secondary address, afterwards it can be addressed at ADDRESS_NETWORK_LAYER.
+// When the address contains wildcards multiple slaves might be selected, this results in an ErrCollision.
+func (handle *MbusHandle) Select(ctx context.Context, address SecondaryAddress) error {
+	request := NewSndUdFrame(ADDRESS_NETWORK_LAYER, CONTROL_INFO_SELECT_SLAVE, address.Bytes(), false)
+
+	_, err := handle.transaction(ctx, request, handle.MaxSearchRetry, verifyAck)
+	return err
+}
+
+// Deselect the selected slave by sending a SND_NKE to ADDRESS_NETWORK_LAYER. Not all slaves acknowledge the
+// deselection and none answers when no slave is selected, so a missing answer is not an error. For the same reason
+// the SND_NKE is not repeated, a retry would only wait for the answer again. A corrupted answer is returned as an
+// ErrCollision, as multiple slaves were selected.
+func (handle *MbusHandle) Deselect(ctx context.Context) error {
+	_, err := handle.transaction(ctx, NewSndNkeFrame(ADDRESS_NETWORK_LAYER), 0, verifyAck)
+
+	if errors.Is(err, ErrTimeout) {
+		return nil
+	}
+
+	return err
+}
+
+// Select the slave with the given secondary address and request its data
+func (handle *MbusHandle) RequestDataSecondary(ctx context.Context, address SecondaryAddress) (*MBusFrame, error) {
+	if err := handle.Select(ctx, address); err != nil {
+		return nil, err
+	}
+
+	return handle.RequestData(ctx, ADDRESS_NETWORK_LAYER)
+}
+
+// Request the data of the slave at the given primary address, when the slave indicates that more records follow
+// (DIF 0x1F) the next telegram is requested by toggling the FCB bit. The telegrams are linked through Next,
+// the data of each telegram is already parsed. A maxFrames of 0 or less means no limit, when the limit is reached
+// while more records follow the telegrams read so far are returned with an ErrTruncated.
+func (handle *MbusHandle) RequestAllData(ctx context.Context, address byte, maxFrames int) (*MBusFrame, error) {
+	var first, last *MBusFrame
+
+	// The FCB is only toggled after a successful transaction,
+	// a repeated request with the same FCB makes the slave send its last telegram again
+	fcb := true
+
+	for i := 0; maxFrames <= 0 || i < maxFrames; i++ {
+		frame, err := handle.requestData(ctx, NewReqUd2Frame(address, fcb))
+		if err != nil {
+			return nil, err
+		}
+		fcb = !fcb
+
+		if err := frame.DataParse(); err != nil {
+			return nil, err
+		}
+
+		if first == nil {
+			first = frame
+		} else {
+			last.Next = frame
+		}
+		last = frame
+
+		if frame.FrameData.Variable == nil || !frame.FrameData.Variable.MoreRecordsFollow {
+			return first, nil
+		}
+	}
+
+	return first, fmt.Errorf("%w: more records follow after %d telegrams", ErrTruncated, maxFrames)
+}
+
+// Request all telegrams of the slave at the given primary address and decode them into a single DecodedFrame.
+// A readout which is truncated by maxFrames is decoded as well and returned with an ErrTruncated.
+func (handle *MbusHandle) Readout(ctx context.Context, address byte, maxFrames int) (*DecodedFrame, error) {
+	frame, err := handle.RequestAllData(ctx, address, maxFrames)
+	if err != nil && !errors.Is(err, ErrTruncated) {
+		return nil, err
+	}
+
+	decoded, decodeErr := frame.DecodeAllFrames()
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	return decoded, err
+}
+
+// The control information which makes a slave switch to the baud rate
+var baudRateControlInformation = map[int]byte{
+	300:   CONTROL_INFO_SET_BAUDRATE_300,
+	600:   CONTROL_INFO_SET_BAUDRATE_600,
+	1200:  CONTROL_INFO_SET_BAUDRATE_1200,
+	2400:  CONTROL_INFO_SET_BAUDRATE_2400,
+	4800:  CONTROL_INFO_SET_BAUDRATE_4800,
+	9600:  CONTROL_INFO_SET_BAUDRATE_9600,
+	19200: CONTROL_INFO_SET_BAUDRATE_19200,
+	38400: CONTROL_INFO_SET_BAUDRATE_38400,
+}
+
+// Switch the slave at the given primary address to another baud rate. The slave acknowledges the switch at the
+// current baud rate, afterwards the local baud rate is changed and the switch is verified with a REQ_UD2.
+// When the slave does not answer at the new baud rate the local baud rate is set back to the original rate.
+// The handles of this package raise their read timeout to the ResponseTimeout of a slower baud rate.
+func (handle *MbusHandle) SetBaudRate(ctx context.Context, address byte, baud int) error {
+	controlInformation, ok := baudRateControlInformation[baud]
+	if !ok {
+		return fmt.Errorf("unsupported baud rate %d", baud)
+	}
+
+	local, ok := handle.wired.(BaudRateHandle)
+	if !ok {
+		return fmt.Errorf("handle does not support changing the baud rate")
+	}
+	original := local.BaudRate()
+
+	request := NewSndUdFrame(address, controlInformation, nil, false)
+	if _, err := handle.transaction(ctx, request, handle.MaxSearchRetry, verifyAck); err != nil {
+		return err
+	}
+
+	if err := local.SetLocalBaudRate(baud); err != nil {
+		return err
+	}
+
+	// Any answer, including an application error, proves that the slave listens at the new baud rate
+	_, err := handle.requestData(ctx, NewReqUd2Frame(address, false))
+	var applicationError *ApplicationError
+	if err == nil || errors.As(err, &applicationError) {
+		return nil
+	}
+
+	if fallbackErr := local.SetLocalBaudRate(original); fallbackErr != nil {
+		return fmt.Errorf("slave 0x%.2X did not answer at %d baud (%s), fallback to %d baud failed: %w", address, baud, err, original, fallbackErr)
+	}
+
+	return fmt.Errorf("slave 0x%.2X did not answer at %d baud, fell back to %d baud: %w", address, baud, original, err)
+}
+
+// Send a REQ_UD1 to the slave at the given primary address to poll for alarms.
+// A slave without alarms answers with an ACK, which results in an alarm status of 0.
+func (handle *MbusHandle) RequestAlarm(ctx context.Context, address byte) (byte, error) {
+	response, err := handle.transaction(ctx, NewReqUd1Frame(address, false), handle.MaxDataRetry, func(response *MBusFrame) error {
+		if response.Type != FRAME_TYPE_ACK && response.Type != FRAME_TYPE_LONG {
+			return fmt.Errorf("%w: expected an ACK or RSP_UD long frame, got frame type %d", ErrInvalidFrame, response.Type)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if response.Type == FRAME_TYPE_ACK {
+		return 0, nil
+	}
+
+	if response.ControlInformation != CONTROL_INFO_STATUS_ALARM {
+		if err := response.ApplicationError(); err != nil {
+			return 0, err
+		}
+
+		return 0, fmt.Errorf("expected a report of alarm status, got control information 0x%.2X", response.ControlInformation)
+	}
+
+	if err := response.DataParse(); err != nil {
+		return 0, err
+	}
+
+	return response.FrameData.Alarm, nil
+}
+
+// Send the request for user data, a report of a general application error is returned as an *ApplicationError
+func (handle *MbusHandle) requestData(ctx context.Context, request *MBusFrame) (*MBusFrame, error) {
+	response, err := handle.transaction(ctx, request, handle.MaxDataRetry, func(response *MBusFrame) error {
+		if response.Type != FRAME_TYPE_LONG {
+			return fmt.Errorf("%w: expected a RSP_UD long frame, got frame type %d", ErrInvalidFrame, response.Type)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := response.ApplicationError(); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Send the request and wait for the answer of the slave, which is checked by the given verify function.
+// Timeouts and invalid answers are retried up to maxRetry times, any other error is returned immediately.
+func (handle *MbusHandle) transaction(ctx context.Context, request *MBusFrame, maxRetry int, verify func(response *MBusFrame) error) (*MBusFrame, error) {
+	if handle.wired == nil {
+		return nil, fmt.Errorf("handle does not support wired M-Bus transactions")
+	}
+
+	var err error
+
+	for retry := 0; retry <= maxRetry; retry++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		if retry > 0 {
+			if DEBUG {
+				fmt.Printf("Retrying request to address 0x%.2X (%d/%d): %s\n", request.Address, retry, maxRetry, err)
+			}
+
+			// The tail of a collision or a late answer would be read as the answer to the repeated request
+			if flusher, ok := handle.wired.(inputFlusher); ok {
+				if err := flusher.flushInput(); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if err = handle.wired.Send(request); err != nil {
+			return nil, err
+		}
+
+		var response *MBusFrame
+		response, err = handle.wired.ReceiveWiredFrame()
+		if err == nil {
+			err = verify(response)
+		}
+
+		if err == nil {
+			return response, nil
+		}
+
+		if !errors.Is(err, ErrTimeout) && !errors.Is(err, ErrInvalidFrame) {
+			return nil, err
+		}
+	}
+
+	if errors.Is(err, ErrInvalidFrame) {
+		return nil, fmt.Errorf("%w (%s)", ErrCollision, err)
+	}
+
+	return nil, err
+}
+
+func verifyAck(response *MBusFrame) error {
+	if response.Type != FRAME_TYPE_ACK {
+		return fmt.Errorf("%w: expected an ACK, got frame type %d", ErrInvalidFrame, response.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,700 @@
+package mbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// A wired bus simulation, each slave answers the requests send to its primary address
+type testBus struct {
+	MbusHandle
+
+	slaves map[byte]func(request *MBusFrame) [][]byte
+
+	requests  []*MBusFrame
+	responses [][]byte
+
+	baud int
+	// Like a real handle the read timeout is raised for a slower baud rate, a slave which answers within its
+	// ResponseTimeout is only received when the read timeout is long enough. 0 disables the timing.
+	readTimeout       time.Duration
+	configuredTimeout time.Duration
+}
+
+func newTestBus() *testBus {
+	bus := &testBus{
+		MbusHandle: MbusHandle{
+			MaxDataRetry:   3,
+			MaxSearchRetry: 3,
+		},
+		slaves: map[byte]func(request *MBusFrame) [][]byte{},
+		baud:   2400,
+	}
+	bus.wired = bus
+
+	return bus
+}
+
+func (bus *testBus) Open(device string, config interface{}) error { return nil }
+func (bus *testBus) Close() error                                 { return nil }
+func (bus *testBus) Stream(ctx context.Context) chan Frame        { return nil }
+func (bus *testBus) ReceiveFrame() (Frame, error)                 { return nil, ErrTimeout }
+
+func (bus *testBus) BaudRate() int { return bus.baud }
+
+func (bus *testBus) SetLocalBaudRate(baud int) error {
+	bus.baud = baud
+	bus.readTimeout = baudReadTimeout(bus.configuredTimeout, baud)
+	return nil
+}
+
+func (bus *testBus) Send(frame Frame) error {
+	data, length := encodeFrame(frame)
+
+	request := NewWiredMBusFrame()
+	if _, err := ParseWiredMBusData(request, &data, length); err != nil {
+		return err
+	}
+	bus.requests = append(bus.requests, request)
+
+	// Collect the addressed slaves first, a slave may change its primary address while answering
+	var addressed []func(request *MBusFrame) [][]byte
+	for address, slave := range bus.slaves {
+		if address == request.Address || request.Address >= ADDRESS_NETWORK_LAYER {
+			addressed = append(addressed, slave)
+		}
+	}
+
+	for _, slave := range addressed {
+		bus.responses = append(bus.responses, slave(request)...)
+	}
+
+	return nil
+}
+
+func (bus *testBus) ReceiveWiredFrame() (*MBusFrame, error) {
+	if bus.readTimeout > 0 && bus.readTimeout < ResponseTimeout(bus.baud) {
+		bus.responses = nil
+	}
+
+	if len(bus.responses) == 0 {
+		return nil, ErrTimeout
+	}
+
+	// Answers which are on the bus at the same time collide
+	data := bus.responses[0]
+	if len(bus.responses) > 1 {
+		data = append([]byte{0x00}, data...)
+	}
+	bus.responses = nil
+
+	frame := NewWiredMBusFrame()
+	if _, err := ParseWiredMBusData(frame, &data, len(data)); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFrame, err)
+	}
+
+	return frame, nil
+}
+
+func TestRequestData(t *testing.T) {
+	bus := newTestBus()
+
+	attempts := 0
+	bus.slaves[0x05] = func(request *MBusFrame) [][]byte {
+		attempts++
+
+		// Only answer the second attempt
+		if attempts < 2 || request.Control&^CONTROL_MASK_FCB != CONTROL_MASK_REQ_UD2 {
+			return nil
+		}
+
+		return [][]byte{testWiredFrame}
+	}
+
+	frame, err := bus.RequestData(context.Background(), 0x05)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got: %d", attempts)
+	}
+
+	if err := frame.DataParse(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bus.RequestData(context.Background(), 0x06); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout, got: %v", err)
+	}
+
+	if len(bus.requests) != 2+1+bus.MaxDataRetry {
+		t.Fatalf("expected %d requests, got: %d", 2+1+bus.MaxDataRetry, len(bus.requests))
+	}
+}
+
+func TestScanPrimary(t *testing.T) {
+	bus := newTestBus()
+
+	ack := func(request *MBusFrame) [][]byte {
+		return [][]byte{{FRAME_ACK_START}}
+	}
+	bus.slaves[0x01] = ack
+	bus.slaves[0x30] = ack
+
+	scanned := 0
+	found, err := bus.ScanPrimary(context.Background(), func(result PrimaryScanResult) {
+		scanned++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scanned != MAX_PRIMARY_SLAVES+1 {
+		t.Fatalf("expected progress for %d addresses, got: %d", MAX_PRIMARY_SLAVES+1, scanned)
+	}
+
+	if len(found) != 2 || found[0].Address != 0x01 || found[1].Address != 0x30 {
+		t.Fatalf("expected slaves at 0x01 and 0x30, got: %+v", found)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	found, err = bus.ScanPrimary(ctx, func(result PrimaryScanResult) {
+		if result.Address == 0x10 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) || len(found) != 1 {
+		t.Fatalf("expected the scan to be cancelled after the first slave, got: %+v (%v)", found, err)
+	}
+}
+
+// A slave which can be selected by its secondary address, it answers with a variable data structure response
+func newTestSecondarySlave(t *testing.T, secondaryAddress string) func(request *MBusFrame) [][]byte {
+	address, err := ParseSecondaryAddress(secondaryAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selected := false
+
+	return func(request *MBusFrame) [][]byte {
+		if request.Address != ADDRESS_NETWORK_LAYER {
+			return nil
+		}
+
+		switch {
+		case request.Control == CONTROL_MASK_SND_NKE:
+			selected = false
+			return nil
+		case request.ControlInformation == CONTROL_INFO_SELECT_SLAVE:
+			var mask SecondaryAddress
+			copy(mask.Id[:], request.Data[0:4])
+			copy(mask.Manufacturer[:], request.Data[4:6])
+			mask.Version = request.Data[6]
+			mask.DeviceType = request.Data[7]
+
+			selected = address.Matches(mask)
+			if selected {
+				return [][]byte{{FRAME_ACK_START}}
+			}
+		case selected && request.Control&^CONTROL_MASK_FCB == CONTROL_MASK_REQ_UD2:
+			response := &MBusFrame{
+				Type:               FRAME_TYPE_LONG,
+				Control:            CONTROL_MASK_RSP_UD,
+				ControlInformation: CONTROL_INFO_RESP_VARIABLE,
+				Data:               append(address.Bytes(), 0x00, 0x00, 0x00, 0x00),
+				DataSize:           DATA_VARIABLE_HEADER_LENGTH,
+			}
+			data, _ := response.Encode()
+			return [][]byte{data}
+		}
+
+		return nil
+	}
+}
+
+// A slave at the given primary address which accepts a new primary address
+func newTestAddressableSlave(bus *testBus, address byte) {
+	var slave func(request *MBusFrame) [][]byte
+	slave = func(request *MBusFrame) [][]byte {
+		if request.ControlInformation == CONTROL_INFO_DATA_SEND && bytes.Equal(request.Data[0:2], []byte{0x01, 0x7A}) {
+			delete(bus.slaves, address)
+			address = request.Data[2]
+			bus.slaves[address] = slave
+		}
+
+		return [][]byte{{FRAME_ACK_START}}
+	}
+	bus.slaves[address] = slave
+}
+
+func TestSetPrimaryAddress(t *testing.T) {
+	bus := newTestBus()
+	newTestAddressableSlave(bus, 0x00)
+
+	if err := bus.SetPrimaryAddress(context.Background(), 0x00, 0x10); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := bus.slaves[0x10]; !ok || len(bus.slaves) != 1 {
+		t.Fatalf("expected the slave at 0x10, got: %v", bus.slaves)
+	}
+
+	last := bus.requests[len(bus.requests)-1]
+	if last.Address != 0x10 || last.Control != CONTROL_MASK_SND_NKE {
+		t.Fatalf("expected the new address to be polled, got: %+v", last)
+	}
+
+	if err := bus.SetPrimaryAddress(context.Background(), 0x10, 0xFD); err == nil {
+		t.Fatalf("expected an error for an invalid primary address")
+	}
+
+	// A slave which acknowledges but keeps its primary address
+	bus.slaves[0x20] = func(request *MBusFrame) [][]byte {
+		return [][]byte{{FRAME_ACK_START}}
+	}
+
+	if err := bus.SetPrimaryAddress(context.Background(), 0x20, 0x21); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected the verification to time out, got: %v", err)
+	}
+}
+
+func TestSecondaryAddress(t *testing.T) {
+	address, err := ParseSecondaryAddress("123456782C2D0104")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(address.Bytes(), []byte{0x78, 0x56, 0x34, 0x12, 0x2D, 0x2C, 0x01, 0x04}) {
+		t.Fatalf("unexpected secondary address bytes: % X", address.Bytes())
+	}
+
+	if address.String() != "123456782C2D0104" {
+		t.Fatalf("expected '123456782C2D0104', got: %s", address)
+	}
+
+	mask, _ := ParseSecondaryAddress("1234FFFFFFFFFFFF")
+	if !address.Matches(mask) || !address.Matches(SecondaryAddressWildcard) {
+		t.Fatalf("expected %s to match %s", address, mask)
+	}
+
+	for _, invalid := range []string{"12345678", "1234567A2C2D0104", "123456782C2D01XX"} {
+		if _, err := ParseSecondaryAddress(invalid); err == nil {
+			t.Fatalf("expected an error for secondary address '%s'", invalid)
+		}
+	}
+}
+
+func TestDeselect(t *testing.T) {
+	bus := newTestBus()
+
+	// No slave answers
+	if err := bus.Deselect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bus.requests) != 1 || bus.requests[0].Address != ADDRESS_NETWORK_LAYER || bus.requests[0].Control != CONTROL_MASK_SND_NKE {
+		t.Fatalf("expected a single SND_NKE to the network layer, got: %+v", bus.requests)
+	}
+
+	ack := func(request *MBusFrame) [][]byte {
+		return [][]byte{{FRAME_ACK_START}}
+	}
+
+	bus.slaves[0x01] = ack
+	if err := bus.Deselect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two selected slaves which acknowledge at the same time
+	bus.slaves[0x02] = ack
+	if err := bus.Deselect(context.Background()); !errors.Is(err, ErrCollision) {
+		t.Fatalf("expected a collision, got: %v", err)
+	}
+}
+
+func TestScanSecondary(t *testing.T) {
+	bus := newTestBus()
+
+	expected := []string{"123456782C2D0104", "123456792C2D0104", "223456782C2D0107"}
+	for i, address := range expected {
+		bus.slaves[byte(i)] = newTestSecondarySlave(t, address)
+	}
+
+	found, err := bus.ScanSecondary(context.Background(), SecondaryAddressWildcard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != len(expected) {
+		t.Fatalf("expected %d slaves, got: %v", len(expected), found)
+	}
+
+	for i, address := range found {
+		if address.String() != expected[i] {
+			t.Fatalf("expected slave %s, got: %s", expected[i], address)
+		}
+	}
+}
+
+func TestReadout(t *testing.T) {
+	bus := newTestBus()
+
+	header := []byte{0x78, 0x56, 0x34, 0x12, 0x2D, 0x2C, 0x01, 0x04, 0x2A, 0x00, 0x00, 0x00}
+	telegrams := [][]byte{
+		append(append([]byte{}, header...), 0x04, 0x06, 0xE8, 0x03, 0x00, 0x00, DIB_DIF_MORE_RECORDS_FOLLOW),
+		append(append([]byte{}, header...), 0x0C, 0x13, 0x27, 0x04, 0x85, 0x02),
+	}
+
+	// The slave only sends its next telegram when the FCB is toggled
+	current := 0
+	lastFcb, requested := false, false
+	bus.slaves[0x07] = func(request *MBusFrame) [][]byte {
+		if request.Control&^CONTROL_MASK_FCB != CONTROL_MASK_REQ_UD2 {
+			return nil
+		}
+
+		fcb := request.Control&CONTROL_MASK_FCB != 0
+		if requested && fcb != lastFcb && current < len(telegrams)-1 {
+			current++
+		}
+		lastFcb, requested = fcb, true
+
+		response := &MBusFrame{
+			Type:               FRAME_TYPE_LONG,
+			Control:            CONTROL_MASK_RSP_UD,
+			Address:            0x07,
+			ControlInformation: CONTROL_INFO_RESP_VARIABLE,
+			Data:               telegrams[current],
+			DataSize:           len(telegrams[current]),
+		}
+		data, _ := response.Encode()
+		return [][]byte{data}
+	}
+
+	decoded, err := bus.Readout(context.Background(), 0x07, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bus.requests) != 2 {
+		t.Fatalf("expected 2 requests, got: %d", len(bus.requests))
+	}
+
+	if len(decoded.DataRecords) != 3 {
+		t.Fatalf("expected 3 data records, got: %d", len(decoded.DataRecords))
+	}
+
+	if decoded.DataRecords[0].Value != "1000" || decoded.DataRecords[2].Value != "2850427" {
+		t.Fatalf("unexpected values: %+v", decoded.DataRecords)
+	}
+
+	// Limit the readout to the first telegram, the partial readout is returned with an error
+	current, requested = 0, false
+	frame, err := bus.RequestAllData(context.Background(), 0x07, 1)
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got: %v", err)
+	}
+
+	if frame == nil || frame.Next != nil {
+		t.Fatalf("expected a single telegram")
+	}
+
+	current, requested = 0, false
+	decoded, err = bus.Readout(context.Background(), 0x07, 1)
+	if !errors.Is(err, ErrTruncated) || decoded == nil || decoded.DataRecords[0].Value != "1000" {
+		t.Fatalf("expected the records of the first telegram with ErrTruncated, got: %v %v", decoded, err)
+	}
+}
+
+func TestApplicationError(t *testing.T) {
+	bus := newTestBus()
+
+	response := func(request *MBusFrame, ci byte, data ...byte) [][]byte {
+		frame := &MBusFrame{
+			Type:               FRAME_TYPE_LONG,
+			Control:            CONTROL_MASK_RSP_UD,
+			Address:            request.Address,
+			ControlInformation: ci,
+			Data:               data,
+			DataSize:           len(data),
+		}
+		encoded, _ := frame.Encode()
+		return [][]byte{encoded}
+	}
+
+	bus.slaves[0x01] = func(request *MBusFrame) [][]byte {
+		return response(request, CONTROL_INFO_ERROR_GENERAL, ERROR_DATA_APPLICATION_BUSY)
+	}
+	bus.slaves[0x02] = func(request *MBusFrame) [][]byte {
+		if request.Control&^CONTROL_MASK_FCB == CONTROL_MASK_REQ_UD1 {
+			return response(request, CONTROL_INFO_STATUS_ALARM, 0x05)
+		}
+		return response(request, CONTROL_INFO_ERROR_GENERAL, ERROR_DATA_TOO_MANY_READOUTS)
+	}
+	bus.slaves[0x03] = func(request *MBusFrame) [][]byte {
+		return [][]byte{{FRAME_ACK_START}}
+	}
+
+	_, err := bus.RequestData(context.Background(), 0x01)
+	if !errors.Is(err, ErrApplicationBusy) || errors.Is(err, ErrTooManyReadouts) {
+		t.Fatalf("expected application busy, got: %v", err)
+	}
+
+	var applicationError *ApplicationError
+	if !errors.As(err, &applicationError) || applicationError.Address != 0x01 {
+		t.Fatalf("expected an application error from 0x01, got: %v", err)
+	}
+
+	if _, err := bus.RequestData(context.Background(), 0x02); !errors.Is(err, ErrTooManyReadouts) {
+		t.Fatalf("expected too many readouts, got: %v", err)
+	}
+
+	// Application errors are not retried
+	if len(bus.requests) != 2 {
+		t.Fatalf("expected 2 requests, got: %d", len(bus.requests))
+	}
+
+	alarm, err := bus.RequestAlarm(context.Background(), 0x02)
+	if err != nil || alarm != 0x05 {
+		t.Fatalf("expected alarm status 0x05, got: 0x%.2X (%v)", alarm, err)
+	}
+
+	alarm, err = bus.RequestAlarm(context.Background(), 0x03)
+	if err != nil || alarm != 0 {
+		t.Fatalf("expected no alarm, got: 0x%.2X (%v)", alarm, err)
+	}
+}
+
+func TestSetBaudRate(t *testing.T) {
+	bus := newTestBus()
+	bus.configuredTimeout = serialReadTimeout(ResponseTimeout(2400))
+	bus.readTimeout = bus.configuredTimeout
+
+	// A slave which switches to the requested baud rate, and one which acknowledges but keeps its baud rate
+	newBaudRateSlave := func(switches bool) func(request *MBusFrame) [][]byte {
+		baud := bus.baud
+
+		return func(request *MBusFrame) [][]byte {
+			if bus.baud != baud {
+				return nil
+			}
+
+			if request.ControlInformation == CONTROL_INFO_SET_BAUDRATE_300 {
+				if switches {
+					baud = 300
+				}
+				return [][]byte{{FRAME_ACK_START}}
+			}
+
+			if request.Control&^CONTROL_MASK_FCB == CONTROL_MASK_REQ_UD2 {
+				return [][]byte{testWiredFrame}
+			}
+
+			return nil
+		}
+	}
+	bus.slaves[0x01] = newBaudRateSlave(true)
+	bus.slaves[0x02] = newBaudRateSlave(false)
+
+	if err := bus.SetBaudRate(context.Background(), 0x01, 300); err != nil {
+		t.Fatal(err)
+	}
+
+	if bus.baud != 300 {
+		t.Fatalf("expected the local baud rate to be 300, got: %d", bus.baud)
+	}
+
+	// The slave answers within 1.15s at 300 baud
+	if bus.readTimeout != 1200*time.Millisecond {
+		t.Fatalf("expected the read timeout to be raised to 1.2s, got: %s", bus.readTimeout)
+	}
+
+	if err := bus.SetLocalBaudRate(2400); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.SetBaudRate(context.Background(), 0x02, 300); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout at the new baud rate, got: %v", err)
+	}
+
+	if bus.baud != 2400 || bus.readTimeout != bus.configuredTimeout {
+		t.Fatalf("expected a fallback to 2400 baud with a read timeout of %s, got: %d %s", bus.configuredTimeout, bus.baud, bus.readTimeout)
+	}
+
+	if err := bus.SetBaudRate(context.Background(), 0x02, 1234); err == nil {
+		t.Fatalf("expected an error for an unsupported baud rate")
+	}
+}
+
+func TestWriteDataRecords(t *testing.T) {
+	records := []*DataRecord{
+		// Reset the counters
+		NewDataRecord(0x00, nil, 0xFD, []byte{0x60}, nil),
+		// Date and time (type F)
+		NewDataRecord(0x04, nil, 0x6D, nil, []byte{0x0D, 0x0E, 0x11, 0x2A}),
+		// Volume at storage number 2, tariff 1
+		NewDataRecord(0x04, []byte{0x11}, 0x13, nil, []byte{0x01, 0x02, 0x03, 0x04}),
+		// Variable length data
+		NewDataRecord(0x0D, nil, 0xFD, []byte{0x0C}, []byte("v1.2")),
+	}
+
+	expected := []byte{
+		0x00, 0xFD, 0x60,
+		0x04, 0x6D, 0x0D, 0x0E, 0x11, 0x2A,
+		0x84, 0x11, 0x13, 0x01, 0x02, 0x03, 0x04,
+		0x0D, 0xFD, 0x0C, 0x04, 'v', '1', '.', '2',
+	}
+
+	data, err := encodeDataRecords(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("expected % X, got: % X", expected, data)
+	}
+
+	// Encoding the parsed records results in the same bytes
+	parsed, err := parseVariableDataRecords(data, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reencoded, err := encodeDataRecords(parsed.DataRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(reencoded, expected) {
+		t.Fatalf("expected % X, got: % X", expected, reencoded)
+	}
+
+	if _, err := NewDataRecord(0x04, nil, 0x13, nil, []byte{0x01}).Encode(); err == nil {
+		t.Fatalf("expected an error for a data length mismatch")
+	}
+
+	bus := newTestBus()
+	bus.slaves[0x05] = func(request *MBusFrame) [][]byte {
+		if request.ControlInformation != CONTROL_INFO_DATA_SEND || !bytes.Equal(request.Data[:request.DataSize], expected) {
+			return nil
+		}
+		return [][]byte{{FRAME_ACK_START}}
+	}
+
+	if err := bus.WriteDataRecords(context.Background(), 0x05, records); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelectiveReadout(t *testing.T) {
+	selector := ReadoutSelector{VIF: 0x13, StorageNumber: 5, Tariff: 2}
+	record, err := selector.DataRecord()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := record.Encode()
+	if !bytes.Equal(data, []byte{0xC8, 0x22, 0x13}) {
+		t.Fatalf("unexpected selection record: % X", data)
+	}
+
+	parsed, err := parseVariableDataRecords(data, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tariff, _ := parsed.DataRecords[0].DecodeTariff()
+	if parsed.DataRecords[0].DecodeStorageNumber() != 5 || tariff != 2 {
+		t.Fatalf("expected storage number 5 and tariff 2, got: %d and %d", parsed.DataRecords[0].DecodeStorageNumber(), tariff)
+	}
+
+	bus := newTestBus()
+
+	header := []byte{0x78, 0x56, 0x34, 0x12, 0x2D, 0x2C, 0x01, 0x04, 0x2A, 0x00, 0x00, 0x00}
+	available := map[byte][]byte{
+		0x06: {0x04, 0x06, 0xE8, 0x03, 0x00, 0x00},
+		0x13: {0x0C, 0x13, 0x27, 0x04, 0x85, 0x02},
+		0x5B: {0x02, 0x5B, 0x2A, 0x00},
+	}
+
+	var selected []byte
+	bus.slaves[0x05] = func(request *MBusFrame) [][]byte {
+		if request.ControlInformation == CONTROL_INFO_DATA_SEND {
+			records, err := parseVariableDataRecords(request.Data, request.DataSize)
+			if err != nil {
+				return nil
+			}
+
+			selected = nil
+			for _, record := range records.DataRecords {
+				if record.DIB.DIF&DATA_RECORD_DIF_MASK_DATA == DIB_DIF_SELECTION {
+					selected = append(selected, record.VIB.VIF)
+				}
+			}
+			return [][]byte{{FRAME_ACK_START}}
+		}
+
+		response := &MBusFrame{
+			Type:               FRAME_TYPE_LONG,
+			Control:            CONTROL_MASK_RSP_UD,
+			Address:            0x05,
+			ControlInformation: CONTROL_INFO_RESP_VARIABLE,
+			Data:               append([]byte{}, header...),
+		}
+		for _, vif := range selected {
+			response.Data = append(response.Data, available[vif]...)
+		}
+		response.DataSize = len(response.Data)
+
+		encoded, _ := response.Encode()
+		return [][]byte{encoded}
+	}
+
+	decoded, err := bus.SelectiveReadout(context.Background(), 0x05, []ReadoutSelector{{VIF: 0x13}, {VIF: 0x5B}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.DataRecords) != 2 || decoded.DataRecords[0].Value != "2850427" || decoded.DataRecords[1].Value != "42.00" {
+		t.Fatalf("unexpected selected data records: %+v", decoded.DataRecords)
+	}
+}
+
+func TestSyncTime(t *testing.T) {
+	bus := newTestBus()
+
+	var received []byte
+	bus.slaves[0x05] = func(request *MBusFrame) [][]byte {
+		if request.ControlInformation != CONTROL_INFO_TIME_SYNC_ABSOLUTE {
+			return nil
+		}
+
+		received = request.Data[:request.DataSize]
+		return [][]byte{{FRAME_ACK_START}}
+	}
+
+	date := time.Date(2021, time.March, 14, 15, 9, 26, 0, time.UTC)
+	if err := bus.SyncTime(context.Background(), 0x05, date); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{TIME_SYNC_TC_SET, 0x1A, 0x09, 0xEF, 0xAE, 0x23, 0x0A}
+	if !bytes.Equal(received, expected) {
+		t.Fatalf("expected % X, got: % X", expected, received)
+	}
+
+	// The year can not be encoded, nothing is sent
+	requests := len(bus.requests)
+	if err := bus.SyncTime(context.Background(), 0x05, time.Date(2081, time.January, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Fatalf("expected an error for the year 2081")
+	}
+
+	if len(bus.requests) != requests {
+		t.Fatalf("expected no request, got: %d", len(bus.requests)-requests)
+	}
+}
@@ -2,9 +2,28 @@ package mbus
 
 import (
     "fmt"
+    "strings"
     "time"
 )
 
+// Fixed data header of a variable data structure response (CI 0x72)
+type MBusHeader struct {
+    // LSB first
+    Id []byte // 4 bytes
+
+    // LSB first
+    Manufacturer []byte // 2 bytes
+
+    Version    byte
+    DeviceType byte
+
+    AccessNumber byte
+    Status       byte
+
+    // LSB first
+    Signature []byte // 2 bytes
+}
+
 // https://github.com/rscada/libmbus/blob/027f6fb6899b902bdd7d0b3230ecccc24f6bc6c3/mbus/mbus-protocol.h#L75
 type MBusFrame struct {
     Start1 byte
@@ -17,6 +36,10 @@ type MBusFrame struct {
     Checksum byte
     Stop byte
 
+    // Only set for variable data structure responses
+    Header MBusHeader
+
+    // Holds the unprocessed bytes, including the fixed data header
     Data []byte
     DataSize int
 
@@ -37,6 +60,375 @@ func NewWiredMBusFrame() *MBusFrame {
     }
 }
 
+// SND_NKE: link reset of the slave at the given primary address
+func NewSndNkeFrame(address byte) *MBusFrame {
+    return &MBusFrame{
+        Type:    FRAME_TYPE_SHORT,
+        Control: CONTROL_MASK_SND_NKE,
+        Address: address,
+    }
+}
+
+// REQ_UD2: request class 2 user data from the slave at the given primary address
+func NewReqUd2Frame(address byte, fcb bool) *MBusFrame {
+    frame := &MBusFrame{
+        Type:    FRAME_TYPE_SHORT,
+        Control: CONTROL_MASK_REQ_UD2,
+        Address: address,
+    }
+
+    if fcb {
+        frame.Control |= CONTROL_MASK_FCB
+    }
+
+    return frame
+}
+
+// SND_UD: send user data to the slave at the given primary address,
+// without any data a control frame is created instead of a long frame
+func NewSndUdFrame(address byte, controlInformation byte, data []byte, fcb bool) *MBusFrame {
+    frame := &MBusFrame{
+        Type:               FRAME_TYPE_LONG,
+        Control:            CONTROL_MASK_SND_UD,
+        Address:            address,
+        ControlInformation: controlInformation,
+        Data:               data,
+        DataSize:           len(data),
+    }
+
+    if frame.DataSize == 0 {
+        frame.Type = FRAME_TYPE_CONTROL
+    }
+
+    if fcb {
+        frame.Control |= CONTROL_MASK_FCB
+    }
+
+    return frame
+}
+
+// REQ_UD1: request class 1 user data (alarms) from the slave at the given primary address
+func NewReqUd1Frame(address byte, fcb bool) *MBusFrame {
+    frame := &MBusFrame{
+        Type:    FRAME_TYPE_SHORT,
+        Control: CONTROL_MASK_REQ_UD1,
+        Address: address,
+    }
+
+    if fcb {
+        frame.Control |= CONTROL_MASK_FCB
+    }
+
+    return frame
+}
+
+func NewAckFrame() *MBusFrame {
+    return &MBusFrame{
+        Type:   FRAME_TYPE_ACK,
+        Start1: FRAME_ACK_START,
+    }
+}
+
+//------------------------------------------------------------------------------
+/// Calculate the checksum of the M-Bus frame. The checksum algorithm is the
+/// arithmetic sum of the frame content, without using carry. Which content
+/// that is included in the checksum calculation depends on the frame type.
+//------------------------------------------------------------------------------
+func (frame *MBusFrame) CalculateChecksum() byte {
+    var checksum byte
+
+    switch frame.Type {
+    case FRAME_TYPE_SHORT:
+        checksum = frame.Control
+        checksum += frame.Address
+        break
+    case FRAME_TYPE_CONTROL, FRAME_TYPE_LONG:
+        checksum = frame.Control
+        checksum += frame.Address
+        checksum += frame.ControlInformation
+
+        for i := 0; i < frame.DataSize; i++ {
+            checksum += frame.Data[i]
+        }
+        break
+    }
+
+    return checksum
+}
+
+// The L-field counts the C, A and CI fields plus the user data
+func (frame *MBusFrame) CalculateLength() int {
+    switch frame.Type {
+    case FRAME_TYPE_CONTROL:
+        return 3
+    case FRAME_TYPE_LONG:
+        return frame.DataSize + 3
+    default:
+        return 0
+    }
+}
+
+func (frame *MBusFrame) VerifyControl() error {
+    switch frame.Type {
+    case FRAME_TYPE_SHORT:
+        if frame.Control != CONTROL_MASK_SND_NKE &&
+            frame.Control != CONTROL_MASK_REQ_UD1 &&
+            frame.Control != (CONTROL_MASK_REQ_UD1 | CONTROL_MASK_FCB) &&
+            frame.Control != CONTROL_MASK_REQ_UD2 &&
+            frame.Control != (CONTROL_MASK_REQ_UD2 | CONTROL_MASK_FCB) {
+            return fmt.Errorf("%w: unknown control code 0x%.2x", ErrUnsupported, frame.Control)
+        }
+        break
+    case FRAME_TYPE_CONTROL, FRAME_TYPE_LONG:
+        if frame.Control != CONTROL_MASK_SND_UD &&
+            frame.Control != (CONTROL_MASK_SND_UD | CONTROL_MASK_FCB) &&
+            frame.Control != CONTROL_MASK_RSP_UD &&
+            frame.Control != (CONTROL_MASK_RSP_UD | CONTROL_MASK_DFC) &&
+            frame.Control != (CONTROL_MASK_RSP_UD | CONTROL_MASK_ACD) &&
+            frame.Control != (CONTROL_MASK_RSP_UD | CONTROL_MASK_DFC | CONTROL_MASK_ACD) {
+            return fmt.Errorf("%w: unknown control code 0x%.2x", ErrUnsupported, frame.Control)
+        }
+        break
+    }
+
+    return nil
+}
+
+func (frame *MBusFrame) Verify() error {
+    switch frame.Type {
+    case FRAME_TYPE_ACK:
+        if frame.Start1 != FRAME_ACK_START {
+            return fmt.Errorf("no valid ack type")
+        }
+
+        return nil
+    case FRAME_TYPE_SHORT:
+        if frame.Start1 != FRAME_SHORT_START {
+            return fmt.Errorf("no frame start")
+        }
+        break
+    case FRAME_TYPE_CONTROL, FRAME_TYPE_LONG:
+        if frame.Start1 != FRAME_LONG_START || frame.Start2 != FRAME_LONG_START {
+            return fmt.Errorf("no frame start")
+        }
+
+        if frame.Length1 != frame.Length2 {
+            return fmt.Errorf("frame length 1 (%d) != frame length 2 (%d)", frame.Length1, frame.Length2)
+        }
+
+        calcLength := frame.CalculateLength()
+        if int(frame.Length1) != calcLength {
+            return fmt.Errorf("frame length (%d) != calc length (%d)", frame.Length1, calcLength)
+        }
+        break
+    default:
+        return fmt.Errorf("unknown frame type %d", frame.Type)
+    }
+
+    if err := frame.VerifyControl(); err != nil {
+        return err
+    }
+
+    if frame.Stop != FRAME_STOP {
+        return fmt.Errorf("no frame stop")
+    }
+
+    checksum := frame.CalculateChecksum()
+    if frame.Checksum != checksum {
+        return fmt.Errorf("%w (0x%.2x != 0x%.2x)", ErrChecksum, frame.Checksum, checksum)
+    }
+
+    return nil
+}
+
+// Encode the frame into its raw bytes, the start, length, checksum and stop fields are filled in.
+// An empty slice is returned when the frame can not be encoded.
+func (frame *MBusFrame) Encode() ([]byte, int) {
+    var pack []byte
+
+    switch frame.Type {
+    case FRAME_TYPE_ACK:
+        frame.Start1 = FRAME_ACK_START
+
+        pack = []byte{frame.Start1}
+        break
+    case FRAME_TYPE_SHORT:
+        frame.Start1 = FRAME_SHORT_START
+        frame.Checksum = frame.CalculateChecksum()
+        frame.Stop = FRAME_STOP
+
+        pack = []byte{
+            frame.Start1,
+            frame.Control,
+            frame.Address,
+            frame.Checksum,
+            frame.Stop,
+        }
+        break
+    case FRAME_TYPE_CONTROL, FRAME_TYPE_LONG:
+        if frame.DataSize > FRAME_DATA_LENGTH || frame.DataSize > len(frame.Data) {
+            return []byte{}, 0
+        }
+
+        frame.Start1 = FRAME_LONG_START
+        frame.Start2 = FRAME_LONG_START
+        frame.Length1 = byte(frame.CalculateLength())
+        frame.Length2 = frame.Length1
+        frame.Checksum = frame.CalculateChecksum()
+        frame.Stop = FRAME_STOP
+
+        pack = []byte{
+            frame.Start1,
+            frame.Length1,
+            frame.Length2,
+            frame.Start2,
+            frame.Control,
+            frame.Address,
+            frame.ControlInformation,
+        }
+
+        pack = append(pack, frame.Data[:frame.DataSize]...)
+        pack = append(pack, frame.Checksum, frame.Stop)
+        break
+    default:
+        return []byte{}, 0
+    }
+
+    return pack, len(pack)
+}
+
+// Read the fixed data header which precedes the data records of a variable data structure response
+func (frame *MBusFrame) decodeHeader() {
+    if frame.ControlInformation != CONTROL_INFO_RESP_VARIABLE || frame.DataSize < DATA_VARIABLE_HEADER_LENGTH {
+        return
+    }
+
+    frame.Header = MBusHeader{
+        Id:           []byte{frame.Data[0], frame.Data[1], frame.Data[2], frame.Data[3]},
+        Manufacturer: []byte{frame.Data[4], frame.Data[5]},
+        Version:      frame.Data[6],
+        DeviceType:   frame.Data[7],
+        AccessNumber: frame.Data[8],
+        Status:       frame.Data[9],
+        Signature:    []byte{frame.Data[10], frame.Data[11]},
+    }
+}
+
+func (frame *MBusFrame) DecodeSerialNumber() (string, error) {
+    var serialNumber int
+    if err := DecodeBCDHEX(frame.Header.Id, 4, &serialNumber); err != nil {
+        return "", err
+    }
+
+    return fmt.Sprintf("%X", serialNumber), nil
+}
+
+func (frame *MBusFrame) DecodeManufacturer() (string, error) {
+    var manufacturer string
+
+    if err := DecodeManufacturerId(frame.Header.Manufacturer, &manufacturer); err != nil {
+        return "", err
+    }
+
+    return manufacturer, nil
+}
+
+func (frame *MBusFrame) DecodeProductName() (string, error) {
+    manufacturer, err := frame.DecodeManufacturer()
+    if err != nil {
+        return "", err
+    }
+
+    return ProductNameLookup(manufacturer, frame.Header.Version)
+}
+
+func (frame *MBusFrame) DecodeDeviceType() (string, error) {
+    return DeviceTypeLookup(frame.Header.DeviceType)
+}
+
+// Status byte as defined in EN 13757-3
+//   - bit 0-1: application status (no error, busy, any error, abnormal situation)
+//   - bit 2:   power low
+//   - bit 3:   permanent error
+//   - bit 4:   temporary error
+//   - bit 5-7: manufacturer specific
+func (frame *MBusFrame) DecodeStatus() (string, error) {
+    var status []string
+
+    switch frame.Header.Status & 0x03 {
+    case 0x01:
+        status = append(status, "Application busy")
+        break
+    case 0x02:
+        status = append(status, "Any application error")
+        break
+    case 0x03:
+        status = append(status, "Abnormal situation")
+        break
+    }
+
+    if frame.Header.Status&0x04 != 0 {
+        status = append(status, "Power low")
+    }
+
+    if frame.Header.Status&0x08 != 0 {
+        status = append(status, "Permanent error")
+    }
+
+    if frame.Header.Status&0x10 != 0 {
+        status = append(status, "Temporary error")
+    }
+
+    if len(status) == 0 {
+        return "OK", nil
+    }
+
+    return strings.Join(status, ", "), nil
+}
+
+func (frame *MBusFrame) ProtocolVersion() (int, error) {
+    return int(frame.Header.Version), nil
+}
+
+// Method that will return true if there is an encryption mode present in the signature
+func (frame *MBusFrame) HasEncryptionMode() bool {
+    return len(frame.Header.Signature) == 2 && frame.Header.Signature[1]&0x0F != 0
+}
+
+// Method that will check if the 2 first data bytes after the header are 0x2F,
+// This will indicate if the data is decrypted or not
+func (frame *MBusFrame) IsDecrypted() bool {
+    if frame.HasEncryptionMode() {
+        return frame.DataSize >= DATA_VARIABLE_HEADER_LENGTH + 2 &&
+            frame.Data[DATA_VARIABLE_HEADER_LENGTH] == 0x2F &&
+            frame.Data[DATA_VARIABLE_HEADER_LENGTH + 1] == 0x2F
+    }
+
+    // Always return true when no encryption mode has been set, data was never encrypted
+    return true
+}
+
+func (frame *MBusFrame) DecryptData(key []byte) error {
+    // No need to decrypt if no Encryption Mode has been set in the Frame
+    if !frame.HasEncryptionMode() {
+        return nil
+    }
+
+    return fmt.Errorf("decryption of wired M-Bus frames is not supported (signature 0x%.2X%.2X)", frame.Header.Signature[1], frame.Header.Signature[0])
+}
+
+func (frame *MBusFrame) DataParse() error {
+    if DEBUG {
+        fmt.Println("Decoding Frame data...")
+    }
+
+    // Frame data is encrypted and not yet unencrypted
+    if frame.HasEncryptionMode() && !frame.IsDecrypted() {
+        return fmt.Errorf("data is not yet decrypted, call `frame.DecryptData(key []byte)` with the correct key")
+    }
+
+    return frame.DecodeDeviceRecords()
+}
 
 func (frame *MBusFrame) DecodeDeviceRecords() error {
     if DEBUG {
@@ -44,38 +436,236 @@ func (frame *MBusFrame) DecodeDeviceRecords() error {
         for i := 0; i < frame.DataSize; i++ {
             fmt.Printf("%.2X ", frame.Data[i])
         }
+        fmt.Println()
     }
 
-    direction := frame.Control & CONTROL_MASK_DIR
-    fmt.Printf("\n0x%.2X\n", direction)
     // Check the direction of the frame ( Slave 2 Master )
-    if direction == CONTROL_MASK_DIR_S2M {
-        if frame.ControlInformation == CONTROL_INFO_ERROR_GENERAL {
-            frame.FrameData.Type = DATA_TYPE_ERROR
-
-            if frame.DataSize > 0 {
-                frame.FrameData.Error = int(frame.Data[0])
-            } else {
-                frame.FrameData.Error = 0
-            }
-        } else if frame.ControlInformation == CONTROL_INFO_RESP_FIXED {
-            if frame.DataSize == 0 {
-                return fmt.Errorf("got not data")
-            }
-
-            frame.FrameData.Type = DATA_TYPE_FIXED
-            // return mbus_data_fixed_parse(frame, &(data->data_fix));
-        } else if frame.ControlInformation == CONTROL_INFO_RESP_VARIABLE {
-            if frame.DataSize == 0 {
-                return fmt.Errorf("got not data")
-            }
-
-            frame.FrameData.Type = DATA_TYPE_VARIABLE
-            // return mbus_data_variable_parse(frame, &(data->data_var));
+    if frame.Control & CONTROL_MASK_DIR != CONTROL_MASK_DIR_S2M {
+        return fmt.Errorf("wrong direction in frame (M2S -> master to slave)")
+    }
+
+    switch frame.ControlInformation {
+    case CONTROL_INFO_ERROR_GENERAL:
+        frame.FrameData.Type = DATA_TYPE_ERROR
+
+        if frame.DataSize > 0 {
+            frame.FrameData.Error = int(frame.Data[0])
         } else {
-            return fmt.Errorf("unknown control information 0x%.2X", frame.ControlInformation)
+            frame.FrameData.Error = 0
+        }
+
+        return frame.ApplicationError()
+    case CONTROL_INFO_STATUS_ALARM:
+        frame.FrameData.Type = DATA_TYPE_ALARM
+
+        if frame.DataSize > 0 {
+            frame.FrameData.Alarm = frame.Data[0]
+        } else {
+            frame.FrameData.Alarm = 0
+        }
+
+        return nil
+    case CONTROL_INFO_RESP_FIXED, CONTROL_INFO_RESP_FIXED_MSB:
+        if frame.DataSize == 0 {
+            return fmt.Errorf("got no data")
+        }
+
+        frame.FrameData.Type = DATA_TYPE_FIXED
+        return frame.DataFixedParse()
+    case CONTROL_INFO_RESP_VARIABLE:
+        if frame.DataSize == 0 {
+            return fmt.Errorf("got no data")
         }
+
+        frame.FrameData.Type = DATA_TYPE_VARIABLE
+        return frame.DataVariableParse()
+    default:
+        return fmt.Errorf("unknown control information 0x%.2X", frame.ControlInformation)
+    }
+}
+
+// https://github.com/rscada/libmbus/blob/6edab86078b33f6c870215df2fb605b8fb2fab60/mbus/mbus-protocol.c#L3038
+func (frame *MBusFrame) DataVariableParse() error {
+    if frame.DataSize < DATA_VARIABLE_HEADER_LENGTH {
+        return fmt.Errorf("premature end of record at header")
+    }
+
+    // The data records follow the fixed data header
+    variableRecord, err := parseVariableDataRecords(
+        frame.Data[DATA_VARIABLE_HEADER_LENGTH:],
+        frame.DataSize - DATA_VARIABLE_HEADER_LENGTH,
+    )
+    if err != nil {
+        return err
+    }
+
+    frame.FrameData.Variable = variableRecord
+
+    return nil
+}
+
+// Returns an *ApplicationError when the slave reported a general application error (CI 0x70), otherwise nil.
+// A report without data is an unspecified error.
+func (frame *MBusFrame) ApplicationError() error {
+    if frame.ControlInformation != CONTROL_INFO_ERROR_GENERAL {
+        return nil
+    }
+
+    err := &ApplicationError{Address: frame.Address, Code: ERROR_DATA_UNSPECIFIED}
+    if frame.DataSize > 0 {
+        err.Code = frame.Data[0]
+    }
+
+    return err
+}
+
+// The alarm status of a report of alarm status (CI 0x71), the meaning of the bits is manufacturer specific
+func (frame *MBusFrame) DecodeAlarmStatus() (string, error) {
+    if frame.FrameData.Type != DATA_TYPE_ALARM {
+        return "", fmt.Errorf("frame is not a report of alarm status, call `frame.DataParse()` first")
+    }
+
+    if frame.FrameData.Alarm == 0 {
+        return "No alarm", nil
+    }
+
+    var alarms []string
+    for bit := uint(0); bit < 8; bit++ {
+        if frame.FrameData.Alarm & (1 << bit) != 0 {
+            alarms = append(alarms, fmt.Sprintf("Alarm %d", bit))
+        }
+    }
+
+    return strings.Join(alarms, ", "), nil
+}
+
+// Based on mbus_data_fixed_parse() from https://github.com/rscada/libmbus
+func (frame *MBusFrame) DataFixedParse() error {
+    fixed, err := parseFixedData(frame.Data, frame.DataSize, frame.ControlInformation == CONTROL_INFO_RESP_FIXED_MSB)
+    if err != nil {
+        return err
+    }
+
+    frame.FrameData.Fixed = fixed
+
+    // The fixed data structure has no manufacturer, version or device type
+    frame.Header = MBusHeader{
+        Id:           fixed.Id,
+        AccessNumber: fixed.AccessNumber,
+        Status:       fixed.Status,
+    }
+
+    return nil
+}
+
+func (frame *MBusFrame) DecodeDataRecords() ([]DecodedDataRecord, error) {
+    if frame.FrameData.Fixed != nil {
+        return frame.FrameData.Fixed.DecodeDataRecords()
+    }
+
+    if frame.FrameData.Variable == nil {
+        return nil, fmt.Errorf("no data records, call `frame.DataParse()` first")
+    }
+
+    return decodeDataRecords(frame.FrameData.Variable.DataRecords)
+}
+
+func (frame *MBusFrame) DecodeFrame() (*DecodedFrame, error) {
+    decodedFrame := &DecodedFrame{
+        ParsedAt: time.Now(),
+        Version:  int(frame.Header.Version),
+        AccessNumber: int16(frame.Header.AccessNumber),
+    }
+
+    if len(frame.Header.Signature) == 2 {
+        decodedFrame.Signature = int16(frame.Header.Signature[0]) | int16(frame.Header.Signature[1]) << 8
+    }
+
+    //Decode serial number
+    serialNumber, err := frame.DecodeSerialNumber()
+    if err != nil {
+        return nil, err
+    }
+    decodedFrame.SerialNumber = serialNumber
+
+    if frame.FrameData.Fixed != nil {
+        return frame.decodeFixedFrame(decodedFrame)
+    }
+
+    // Decode manufacturer
+    manufacturer, err := frame.DecodeManufacturer()
+    if err != nil {
+        return nil, err
+    }
+    decodedFrame.Manufacturer = manufacturer
+
+    // Decode product name, most wired meters are not listed so leave it empty when it's unknown
+    productName, err := frame.DecodeProductName()
+    if err == nil {
+        decodedFrame.ProductName = productName
+    }
+
+    // Decode device type
+    deviceType, err := frame.DecodeDeviceType()
+    if err != nil {
+        return nil, err
+    }
+    decodedFrame.DeviceType = deviceType
+
+    // Decode status
+    status, err := frame.DecodeStatus()
+    if err != nil {
+        return nil, err
+    }
+    decodedFrame.Status = int(frame.Header.Status)
+    decodedFrame.ReadableStatus = status
+
+    // Decode data records
+    decodedDeviceRecords, err := frame.DecodeDataRecords()
+    if err != nil {
+        return nil, err
+    }
+    decodedFrame.DataRecords = decodedDeviceRecords
+
+    return decodedFrame, nil
+}
+
+// Decode the remainder of a fixed data structure response, it has no manufacturer and its own medium table
+func (frame *MBusFrame) decodeFixedFrame(decodedFrame *DecodedFrame) (*DecodedFrame, error) {
+    decodedFrame.DeviceType = FixedMediumLookup(frame.FrameData.Fixed.Medium())
+
+    status, err := frame.DecodeStatus()
+    if err != nil {
+        return nil, err
+    }
+    decodedFrame.Status = int(frame.Header.Status)
+    decodedFrame.ReadableStatus = status
+
+    decodedDeviceRecords, err := frame.DecodeDataRecords()
+    if err != nil {
+        return nil, err
+    }
+    decodedFrame.DataRecords = decodedDeviceRecords
+
+    return decodedFrame, nil
+}
+
+// Decode this frame and append the data records of the frames linked through Next,
+// the data of every frame has to be parsed already
+func (frame *MBusFrame) DecodeAllFrames() (*DecodedFrame, error) {
+    decodedFrame, err := frame.DecodeFrame()
+    if err != nil {
+        return nil, err
+    }
+
+    for next := frame.Next; next != nil; next = next.Next {
+        decodedDeviceRecords, err := next.DecodeDataRecords()
+        if err != nil {
+            return nil, err
+        }
+
+        decodedFrame.DataRecords = append(decodedFrame.DataRecords, decodedDeviceRecords...)
     }
 
-    return fmt.Errorf("wrong direction in frame (M2S -> master to slave)")
+    return decodedFrame, nil
 }
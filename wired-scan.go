@@ -0,0 +1,134 @@
+package mbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type PrimaryScanResult struct {
+	Address byte
+
+	// A slave answered at this address
+	Found bool
+	// More than one slave answered at this address
+	Collision bool
+}
+
+// Scan the bus for slaves by sending a SND_NKE to every primary address (0 up to and including MAX_PRIMARY_SLAVES).
+// The progress callback (optional) is called for each address, the found slaves are returned.
+// When the context is cancelled the slaves found so far are returned together with the context error.
+func (handle *MbusHandle) ScanPrimary(ctx context.Context, progress func(result PrimaryScanResult)) ([]PrimaryScanResult, error) {
+	var found []PrimaryScanResult
+
+	for address := 0; address <= MAX_PRIMARY_SLAVES; address++ {
+		result := PrimaryScanResult{
+			Address: byte(address),
+		}
+
+		err := handle.Ping(ctx, result.Address)
+		switch {
+		case err == nil:
+			result.Found = true
+			break
+		case errors.Is(err, ErrCollision):
+			result.Found = true
+			result.Collision = true
+			break
+		case errors.Is(err, ErrTimeout):
+			break
+		default:
+			return found, err
+		}
+
+		if result.Found {
+			found = append(found, result)
+		}
+
+		if progress != nil {
+			progress(result)
+		}
+	}
+
+	return found, nil
+}
+
+// Search the bus for slaves by their secondary address, only the slaves matching the mask are searched.
+// The wildcard digits of the Id in the mask are replaced one by one, when multiple slaves answer
+// the search continues with the next digit, until a single slave answers. The progress callback (optional)
+// is called for each found slave, the found slaves are returned. When the context is cancelled the slaves
+// found so far are returned together with the context error.
+func (handle *MbusHandle) ScanSecondary(ctx context.Context, mask SecondaryAddress, progress func(address SecondaryAddress)) ([]SecondaryAddress, error) {
+	var found []SecondaryAddress
+
+	// Make sure no slave is still selected from an earlier selection
+	if err := handle.Deselect(ctx); err != nil {
+		return nil, err
+	}
+
+	err := handle.scanSecondary(ctx, 0, mask, func(address SecondaryAddress) {
+		found = append(found, address)
+
+		if progress != nil {
+			progress(address)
+		}
+	})
+
+	return found, err
+}
+
+// Based on mbus_scan_2nd_address_range() from https://github.com/rscada/libmbus
+func (handle *MbusHandle) scanSecondary(ctx context.Context, position int, mask SecondaryAddress, found func(address SecondaryAddress)) error {
+	if position > 7 {
+		return nil
+	}
+
+	// Only the wildcard digits have to be searched
+	if mask.IdDigit(position) != 0x0F {
+		return handle.scanSecondary(ctx, position+1, mask, found)
+	}
+
+	for digit := byte(0); digit <= 9; digit++ {
+		probe := mask.WithIdDigit(position, digit)
+
+		address, err := handle.probeSecondary(ctx, probe)
+		switch {
+		case err == nil:
+			found(address)
+			break
+		case errors.Is(err, ErrCollision):
+			if position == 7 {
+				// Multiple slaves with the same Id, they only differ in manufacturer, version or medium
+				if DEBUG {
+					fmt.Printf("Collision at fully specified secondary address %s\n", probe)
+				}
+				break
+			}
+
+			if err := handle.scanSecondary(ctx, position+1, probe, found); err != nil {
+				return err
+			}
+			break
+		case errors.Is(err, ErrTimeout):
+			break
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Select the slaves matching the mask, when a single slave answers its data is requested to get its secondary address
+func (handle *MbusHandle) probeSecondary(ctx context.Context, mask SecondaryAddress) (SecondaryAddress, error) {
+	if err := handle.Select(ctx, mask); err != nil {
+		return SecondaryAddress{}, err
+	}
+
+	frame, err := handle.RequestData(ctx, ADDRESS_NETWORK_LAYER)
+	if err != nil {
+		return SecondaryAddress{}, err
+	}
+
+	return frame.SecondaryAddress()
+}
@@ -0,0 +1,66 @@
+package mbus
+
+import (
+	"context"
+	"fmt"
+)
+
+// DIF of a selection record, which asks the slave to only answer the records with the given VIB
+const DIB_DIF_SELECTION = 0x08
+
+// Selects the records with the VIF (and VIFEs), storage number and tariff for a selective readout
+type ReadoutSelector struct {
+	VIF  byte
+	VIFe []byte
+
+	StorageNumber int
+	Tariff        int
+}
+
+// The selection record (DIF 0x08) for this selector, the reverse of DecodeStorageNumber and DecodeTariff
+func (selector ReadoutSelector) DataRecord() (*DataRecord, error) {
+	if selector.StorageNumber < 0 || selector.Tariff < 0 {
+		return nil, fmt.Errorf("invalid storage number %d or tariff %d", selector.StorageNumber, selector.Tariff)
+	}
+
+	dif := byte(DIB_DIF_SELECTION)
+	dif |= byte(selector.StorageNumber&0x01) << 6
+
+	// Each DIFE holds 4 more bits of the storage number and 2 more bits of the tariff
+	var difes []byte
+	storageNumber := selector.StorageNumber >> 1
+	tariff := selector.Tariff
+
+	for storageNumber > 0 || tariff > 0 {
+		if len(difes) >= 10 {
+			return nil, fmt.Errorf("storage number %d or tariff %d requires more than 10 DIFEs", selector.StorageNumber, selector.Tariff)
+		}
+
+		difes = append(difes, byte(storageNumber&0x0F)|byte(tariff&0x03)<<4)
+		storageNumber >>= 4
+		tariff >>= 2
+	}
+
+	return NewDataRecord(dif, difes, selector.VIF, selector.VIFe, nil), nil
+}
+
+// Send the selection records to the slave at the given primary address and read out the selected records.
+// The slave only answers the records matching one of the selectors, which shortens the readout.
+func (handle *MbusHandle) SelectiveReadout(ctx context.Context, address byte, selectors []ReadoutSelector) (*DecodedFrame, error) {
+	records := make([]*DataRecord, 0, len(selectors))
+
+	for _, selector := range selectors {
+		record, err := selector.DataRecord()
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	if err := handle.WriteDataRecords(ctx, address, records); err != nil {
+		return nil, err
+	}
+
+	return handle.Readout(ctx, address, 0)
+}
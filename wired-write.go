@@ -0,0 +1,54 @@
+package mbus
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Write the data records to the slave at the given primary address with a SND_UD and wait for its ACK.
+// E.g. NewDataRecord(0x00, nil, 0xFD, []byte{0x60}, nil) resets the counters of a slave.
+func (handle *MbusHandle) WriteDataRecords(ctx context.Context, address byte, records []*DataRecord) error {
+	return handle.writeDataRecords(ctx, address, CONTROL_INFO_DATA_SEND, records, handle.MaxDataRetry)
+}
+
+// Select the slave with the given secondary address and write the data records to it
+func (handle *MbusHandle) WriteDataRecordsSecondary(ctx context.Context, address SecondaryAddress, records []*DataRecord) error {
+	if err := handle.Select(ctx, address); err != nil {
+		return err
+	}
+
+	return handle.WriteDataRecords(ctx, ADDRESS_NETWORK_LAYER, records)
+}
+
+// Set the clock of the slave at the given primary address with the time synchronisation command (CI 0x6C).
+// The application data is not a data record, but the TC byte followed by the plain type I date and time in the
+// time zone of t.
+func (handle *MbusHandle) SyncTime(ctx context.Context, address byte, t time.Time) error {
+	dateTime, err := EncodeDateTimeI(t)
+	if err != nil {
+		return err
+	}
+
+	data := append([]byte{TIME_SYNC_TC_SET}, dateTime...)
+	request := NewSndUdFrame(address, CONTROL_INFO_TIME_SYNC_ABSOLUTE, data, false)
+
+	_, err = handle.transaction(ctx, request, handle.MaxDataRetry, verifyAck)
+	return err
+}
+
+func (handle *MbusHandle) writeDataRecords(ctx context.Context, address byte, controlInformation byte, records []*DataRecord, maxRetry int) error {
+	if len(records) == 0 {
+		return fmt.Errorf("no data records to write")
+	}
+
+	data, err := encodeDataRecords(records)
+	if err != nil {
+		return err
+	}
+
+	request := NewSndUdFrame(address, controlInformation, data, false)
+
+	_, err = handle.transaction(ctx, request, maxRetry, verifyAck)
+	return err
+}
@@ -0,0 +1,210 @@
+package mbus
+
+import (
+	"fmt"
+)
+
+// Layout of the link layer CRCs of a wireless frame, see EN 13757-4
+type FrameFormat int
+
+const (
+	// The CRCs are not part of the frame, e.g. they were checked and removed by the dongle
+	FRAME_FORMAT_NONE FrameFormat = iota
+	// A CRC after the first block of 10 bytes and after every next block of 16 bytes, the L-field excludes the CRCs
+	FRAME_FORMAT_A
+	// A CRC after the second block (at most 128 bytes including the first block) and after the optional third
+	// block, the L-field includes the CRCs
+	FRAME_FORMAT_B
+)
+
+const (
+	WIRELESS_CRC_POLYNOMIAL = 0x3D65
+
+	WIRELESS_BLOCK_SIZE_FIRST   = 10
+	WIRELESS_BLOCK_SIZE_A       = 16
+	WIRELESS_BLOCK_SIZE_B_FIRST = 128
+)
+
+func (format FrameFormat) String() string {
+	switch format {
+	case FRAME_FORMAT_NONE:
+		return "none"
+	case FRAME_FORMAT_A:
+		return "A"
+	case FRAME_FORMAT_B:
+		return "B"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(format))
+	}
+}
+
+// CRC-16 of the wireless link layer: polynomial 0x3D65, initial value 0 and the result inverted
+func WirelessCRC(data []byte) uint16 {
+	var crc uint16
+
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ WIRELESS_CRC_POLYNOMIAL
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return ^crc
+}
+
+// Size of a frame in format A including the CRCs, from the L-field up to the last CRC
+func frameSizeA(length byte) int {
+	if length < WIRELESS_BLOCK_SIZE_FIRST-1 {
+		return 0
+	}
+
+	data := int(length) + 1 - WIRELESS_BLOCK_SIZE_FIRST
+	blocks := 1 + (data+WIRELESS_BLOCK_SIZE_A-1)/WIRELESS_BLOCK_SIZE_A
+
+	return int(length) + 1 + 2*blocks
+}
+
+// Size of a frame in format B, from the L-field up to the last CRC
+func frameSizeB(length byte) int {
+	return int(length) + 1
+}
+
+// Verify and remove the link layer CRCs of a wireless frame, which starts with the L-field. The format is detected
+// from the size of the frame. The L-field of the returned frame is updated to exclude the CRCs.
+func StripFrameCRC(data []byte) ([]byte, FrameFormat, error) {
+	if len(data) == 0 {
+		return nil, FRAME_FORMAT_NONE, newFrameError(&data, 0, 0, ErrFraming, fmt.Errorf("got no data"))
+	}
+
+	switch len(data) {
+	case frameSizeB(data[0]):
+		stripped, err := stripFrameCRC(data, FRAME_FORMAT_B)
+		return stripped, FRAME_FORMAT_B, err
+	case frameSizeA(data[0]):
+		stripped, err := stripFrameCRC(data, FRAME_FORMAT_A)
+		return stripped, FRAME_FORMAT_A, err
+	}
+
+	return nil, FRAME_FORMAT_NONE, newFrameError(&data, len(data), 0, ErrFraming,
+		fmt.Errorf("frame size %d does not match L-field 0x%.2X in format A or B", len(data), data[0]))
+}
+
+// Insert the link layer CRCs into a wireless frame, which starts with the L-field and holds no CRCs. The L-field
+// is updated to include the CRCs for format B.
+func EncodeFrameCRC(data []byte, format FrameFormat) ([]byte, error) {
+	if len(data) < WIRELESS_BLOCK_SIZE_FIRST {
+		return nil, fmt.Errorf("frame too short (%d bytes)", len(data))
+	}
+
+	var blocks [][]byte
+
+	switch format {
+	case FRAME_FORMAT_A:
+		blocks = append(blocks, data[:WIRELESS_BLOCK_SIZE_FIRST])
+
+		for start := WIRELESS_BLOCK_SIZE_FIRST; start < len(data); start += WIRELESS_BLOCK_SIZE_A {
+			end := start + WIRELESS_BLOCK_SIZE_A
+			if end > len(data) {
+				end = len(data)
+			}
+
+			blocks = append(blocks, data[start:end])
+		}
+		break
+	case FRAME_FORMAT_B:
+		if len(data) <= WIRELESS_BLOCK_SIZE_B_FIRST-2 {
+			blocks = append(blocks, data)
+		} else {
+			blocks = append(blocks, data[:WIRELESS_BLOCK_SIZE_B_FIRST-2], data[WIRELESS_BLOCK_SIZE_B_FIRST-2:])
+		}
+		break
+	default:
+		return nil, fmt.Errorf("unsupported frame format %s", format)
+	}
+
+	// The L-field of format A excludes the CRCs, of format B it includes them
+	length := len(data) - 1
+	if format == FRAME_FORMAT_B {
+		length += 2 * len(blocks)
+	}
+
+	if length > 0xFF {
+		return nil, fmt.Errorf("frame of %d bytes is too long for format %s", len(data), format)
+	}
+
+	encoded := make([]byte, 0, len(data)+2*len(blocks))
+	for i, block := range blocks {
+		start := len(encoded)
+		encoded = append(encoded, block...)
+
+		if i == 0 {
+			encoded[0] = byte(length)
+		}
+
+		crc := WirelessCRC(encoded[start:])
+		encoded = append(encoded, byte(crc>>8), byte(crc))
+	}
+
+	return encoded, nil
+}
+
+// Verify and remove the CRCs of a frame in the given format, the size of data should match the format
+func stripFrameCRC(data []byte, format FrameFormat) ([]byte, error) {
+	// End of each block including its CRC, and where the data covered by the CRC starts
+	var ends, starts []int
+
+	switch format {
+	case FRAME_FORMAT_A:
+		ends = append(ends, WIRELESS_BLOCK_SIZE_FIRST+2)
+		starts = append(starts, 0)
+
+		for end := WIRELESS_BLOCK_SIZE_FIRST + 2; end < len(data); end += WIRELESS_BLOCK_SIZE_A + 2 {
+			starts = append(starts, end)
+			ends = append(ends, end+WIRELESS_BLOCK_SIZE_A+2)
+		}
+		break
+	case FRAME_FORMAT_B:
+		// The CRC of the second block covers the first block as well
+		ends = append(ends, WIRELESS_BLOCK_SIZE_B_FIRST)
+		starts = append(starts, 0)
+
+		if len(data) > WIRELESS_BLOCK_SIZE_B_FIRST {
+			starts = append(starts, WIRELESS_BLOCK_SIZE_B_FIRST)
+			ends = append(ends, len(data))
+		}
+		break
+	default:
+		return nil, fmt.Errorf("unsupported frame format %s", format)
+	}
+
+	stripped := make([]byte, 0, len(data))
+
+	for block := range ends {
+		end := ends[block]
+		if end > len(data) {
+			end = len(data)
+		}
+
+		if end-starts[block] < 3 {
+			return nil, newFrameError(&data, len(data), starts[block], ErrFraming, fmt.Errorf("block %d is too short", block+1))
+		}
+
+		expected := WirelessCRC(data[starts[block] : end-2])
+		received := uint16(data[end-2])<<8 | uint16(data[end-1])
+
+		if received != expected {
+			return nil, newFrameError(&data, len(data), end-2, ErrChecksum,
+				fmt.Errorf("%w in block %d (0x%.4X != 0x%.4X)", ErrChecksum, block+1, received, expected))
+		}
+
+		stripped = append(stripped, data[starts[block]:end-2]...)
+	}
+
+	stripped[0] = byte(len(stripped) - 1)
+	return stripped, nil
+}
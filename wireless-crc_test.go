@@ -0,0 +1,122 @@
+package mbus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The telegram of testFrame without the start byte, stop byte and CRC
+func testLinkFrame() []byte {
+	frame := append([]byte{}, testFrame[1:len(testFrame)-3]...)
+	frame[0] = byte(len(frame) - 1)
+
+	return frame
+}
+
+func TestWirelessCRC(t *testing.T) {
+	if crc := WirelessCRC([]byte("123456789")); crc != 0xC2B7 {
+		t.Fatalf("expected CRC 0xC2B7, got: 0x%.4X", crc)
+	}
+}
+
+func TestStripFrameCRC(t *testing.T) {
+	long := make([]byte, 200)
+	long[0] = byte(len(long) - 1)
+
+	for _, frame := range [][]byte{testLinkFrame(), long} {
+		for _, format := range []FrameFormat{FRAME_FORMAT_A, FRAME_FORMAT_B} {
+			encoded, err := EncodeFrameCRC(frame, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stripped, detected, err := StripFrameCRC(encoded)
+			if err != nil {
+				t.Fatalf("format %s: %s", format, err)
+			}
+
+			if detected != format || !bytes.Equal(stripped, frame) {
+				t.Fatalf("format %s: unexpected frame in format %s: % X", format, detected, stripped)
+			}
+		}
+	}
+
+	encoded, err := EncodeFrameCRC(testLinkFrame(), FRAME_FORMAT_A)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt a byte of the third block, which ends with a CRC at offset 46
+	encoded[40] ^= 0xFF
+
+	_, _, err = StripFrameCRC(encoded)
+
+	var frameErr *FrameError
+	if !errors.As(err, &frameErr) || !errors.Is(err, ErrChecksum) {
+		t.Fatalf("expected a checksum error, got: %v", err)
+	}
+
+	if frameErr.Offset != 46 || !strings.Contains(err.Error(), "block 3") {
+		t.Fatalf("expected the CRC of block 3 at offset 46, got: %s (offset %d)", err, frameErr.Offset)
+	}
+}
+
+func TestWirelessFramerLinkLayerCRC(t *testing.T) {
+	wrap := func(format FrameFormat) []byte {
+		encoded, err := EncodeFrameCRC(testLinkFrame(), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return append(append([]byte{FRAME_LONG_START}, encoded...), FRAME_STOP)
+	}
+
+	corrupted := wrap(FRAME_FORMAT_B)
+	corrupted[20] ^= 0x01
+
+	var data []byte
+	data = append(data, 0x00, 0x68, 0x01)
+	data = append(data, wrap(FRAME_FORMAT_A)...)
+	data = append(data, corrupted...)
+	data = append(data, wrap(FRAME_FORMAT_B)...)
+
+	framer := NewWirelessFramer(&chunkReader{chunks: chunked(data, 5)})
+	framer.LinkLayerCRC = true
+
+	frames, errs := readFrames(framer)
+
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got: %d (%v)", len(frames), errs)
+	}
+
+	for i, format := range []FrameFormat{FRAME_FORMAT_A, FRAME_FORMAT_B} {
+		frame := frames[i].(*WMBusFrame)
+
+		if frame.Format != format || frame.Raw[0] != FRAME_LONG_START || frame.Raw[len(frame.Raw)-1] != FRAME_STOP {
+			t.Fatalf("frame %d: unexpected frame in format %s: % X", i, frame.Format, frame.Raw)
+		}
+
+		serial, err := frame.DecodeSerialNumber()
+		if err != nil || serial != "25653" {
+			t.Fatalf("frame %d: unexpected serial number: %s (%v)", i, serial, err)
+		}
+	}
+
+	// The recorded telegram holds the CRCs, which are removed again when it is replayed
+	replayed, err := parseCaptureLine(hex.EncodeToString(frames[0].(*WMBusFrame).Raw))
+	if err != nil || replayed.Format != FRAME_FORMAT_A {
+		t.Fatalf("expected a replayed frame in format A, got: %v", err)
+	}
+
+	checksum := false
+	for _, err := range errs {
+		checksum = checksum || errors.Is(err, ErrChecksum)
+	}
+
+	if !checksum {
+		t.Fatalf("expected a checksum error for the corrupted frame, got: %v", errs)
+	}
+}
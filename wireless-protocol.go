@@ -47,6 +47,15 @@ type WMBusFrame struct {
 
 	Timestamp time.Time
 
+	// Received signal strength in dBm and the link quality indicator, 0 when unknown
+	RSSI int
+	LQI  int
+
+	// The bytes as they were received, without the trailer of the receive profile
+	Raw []byte
+	// Layout of the link layer CRCs in Raw
+	Format FrameFormat
+
 	CRCEnabled  bool
 	RSSIEnabled bool
 }
@@ -63,6 +72,22 @@ func NewWirelessMBusFrame() *WMBusFrame {
 	}
 }
 
+func (frame *WMBusFrame) Encode() ([]byte, int) {
+	switch frame.Type {
+	case FRAME_TYPE_ACK:
+		telegram := TelegramACK(*frame)
+		return telegram.Encode()
+	case FRAME_TYPE_SHORT:
+		telegram := TelegramShort(*frame)
+		return telegram.Encode()
+	case FRAME_TYPE_CONTROL, FRAME_TYPE_LONG:
+		telegram := TelegramLong(*frame)
+		return telegram.Encode()
+	default:
+		return []byte{}, 0
+	}
+}
+
 func (frame *WMBusFrame) DecodeSerialNumber() (string, error) {
 	var serialNumber int
 	if err := DecodeBCDHEX(frame.Header.Id, 4, &serialNumber); err != nil {
@@ -73,19 +98,13 @@ func (frame *WMBusFrame) DecodeSerialNumber() (string, error) {
 }
 
 func (frame *WMBusFrame) DecodeManufacturer() (string, error) {
-	var manufacturerId int
+	var manufacturer string
 
-	if err := DecodeInt(frame.Header.Manufacturer, len(frame.Header.Manufacturer), &manufacturerId); err != nil {
+	if err := DecodeManufacturerId(frame.Header.Manufacturer, &manufacturer); err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf(
-		"%s%s%s%s",
-		string(((manufacturerId>>10)&0x001F)+64),
-		string(((manufacturerId>>5)&0x001F)+64),
-		string((manufacturerId&0x001F)+64),
-		"",
-	), nil
+	return manufacturer, nil
 }
 
 func (frame *WMBusFrame) DecodeProductName() (string, error) {
@@ -94,16 +113,7 @@ func (frame *WMBusFrame) DecodeProductName() (string, error) {
 		return "", err
 	}
 
-	_, ok := products[manufacturer]
-	if !ok {
-		return "", fmt.Errorf("could not find manufacturer: %s", manufacturer)
-	}
-
-	if productName, ok := products[manufacturer][frame.Header.Version]; ok {
-		return productName, nil
-	}
-
-	return "", fmt.Errorf("could not find device type: 0x%.2X, for manufacturer: %s", frame.Header.DeviceType, manufacturer)
+	return ProductNameLookup(manufacturer, frame.Header.Version)
 }
 
 func (frame *WMBusFrame) DecodeStatus() (string, error) {
@@ -285,228 +295,14 @@ func (frame *WMBusFrame) DataParse() error {
 	return nil
 }
 
-// https://github.com/rscada/libmbus/blob/6edab86078b33f6c870215df2fb605b8fb2fab60/mbus/mbus-protocol.c#L3038
 func (frame *WMBusFrame) DataVariableParse() error {
-	variableRecord := &VariableData{
-		MoreRecordsFollow: false,
+	variableRecord, err := parseVariableDataRecords(frame.Data, frame.DataSize)
+	if err != nil {
+		return err
 	}
 
 	frame.FrameData.Variable = variableRecord
 
-	i := 0
-	dr := 0
-
-	for {
-		if i > frame.DataSize-1 {
-			break
-		}
-
-		// Skip filler bytes (0x2F)
-		// First 2 encryption verification bytes for example ( if present )
-		// And the filler bytes at the end to create the aes blocksize length
-		if frame.Data[i]&0xFF == DIB_DIF_IDLE_FILLER {
-			if DEBUG {
-				if i < 2 {
-					fmt.Printf("Skipping encryption verification byte\n")
-				} else {
-					fmt.Printf("Skipping filler byte\n")
-				}
-			}
-
-			i++
-			continue
-		}
-
-		// read and parse DIB (= DIF + DIFE)
-		record := &DataRecord{}
-
-		if DEBUG {
-			dr++
-			fmt.Printf("DR %d :: ", dr)
-		}
-
-		// DIF
-		record.DIB.DIF = frame.Data[i]
-
-		if DEBUG {
-			fmt.Printf("DIB.DIF: 0x%.2X; ", frame.Data[i])
-		}
-
-		if record.DIB.DIF == DIB_DIF_MANUFACTURER_SPECIFIC || record.DIB.DIF == DIB_DIF_MORE_RECORDS_FOLLOW {
-			if record.DIB.DIF&0xFF == DIB_DIF_MORE_RECORDS_FOLLOW {
-				variableRecord.MoreRecordsFollow = true
-			}
-
-			i++
-
-			record.DataSize = frame.DataSize - i
-			record.Data = make([]byte, record.DataSize)
-
-			for j := 0; j < record.DataSize; j++ {
-				i++
-				record.Data[j] = frame.Data[i]
-			}
-
-			variableRecord.DataRecords = append(variableRecord.DataRecords, record)
-			continue
-		}
-
-		record.DataSize = DataLengthLookup(record.DIB.DIF)
-
-		if DEBUG {
-			fmt.Printf("Data length lookup: %d; ", record.DataSize)
-		}
-
-		record.DIB.NDIFe = 0
-		record.DIB.DIFe = make([]byte, 10)
-
-		for {
-			if i > frame.DataSize || frame.Data[i]&DIB_DIF_EXTENSION_BIT == 0 {
-				break
-			}
-
-			if record.DIB.NDIFe >= len(record.DIB.DIFe) {
-				return fmt.Errorf("too many DIFE")
-			}
-
-			dife := frame.Data[i+1]
-			record.DIB.DIFe[record.DIB.NDIFe] = dife
-
-			record.DIB.NDIFe++
-			i++
-		}
-		i++
-
-		if i > frame.DataSize {
-			return fmt.Errorf("premature end of record at DIF")
-		}
-
-		// read and parse VIB (= VIF + VIFE)
-
-		// VIF
-		record.VIB.VIF = frame.Data[i]
-
-		if DEBUG {
-			fmt.Printf("VIB.VIF: 0x%.2X; ", record.VIB.VIF)
-		}
-
-		if record.VIB.VIF&DIB_VIF_WITHOUT_EXTENSION == 0x7C {
-			i++
-			variableVIFLength := int(frame.Data[i])
-			if variableVIFLength > len(record.VIB.Custom) {
-				return fmt.Errorf("too long variable length VIF")
-			}
-
-			if i+variableVIFLength > frame.DataSize {
-				return fmt.Errorf("premature end of record at variable length VIF")
-			}
-
-			if err := DecodeString(&frame.Data[i], &variableVIFLength, &record.VIB.Custom); err != nil {
-				return err
-			}
-
-			i += variableVIFLength
-		}
-
-		// VIFE
-		record.VIB.NVIFe = 0
-
-		if record.VIB.VIF&DIB_VIF_EXTENSION_BIT != 0 {
-			record.VIB.VIFe = make([]byte, 10)
-			record.VIB.VIFe[0] = frame.Data[i]
-			record.VIB.NVIFe++
-
-			for {
-				if i > frame.DataSize || frame.Data[i]&DIB_DIF_EXTENSION_BIT == 0 {
-					break
-				}
-
-				if record.VIB.NVIFe >= len(record.VIB.VIFe) {
-					return fmt.Errorf("too many VIFE")
-				}
-
-				vife := frame.Data[i+1]
-				record.VIB.VIFe[record.VIB.NVIFe] = vife
-
-				record.VIB.NVIFe++
-				i++
-			}
-			// This should not be here
-			// https://github.com/rscada/libmbus/blob/6edab86078b33f6c870215df2fb605b8fb2fab60/mbus/mbus-protocol.c#L3202
-			//i++
-		}
-
-		if DEBUG {
-			if record.VIB.NVIFe > 0 {
-				fmt.Printf("VIFe:")
-				for i := 0; i < record.VIB.NVIFe-1; i++ {
-					fmt.Printf(" 0x%.2X", record.VIB.VIFe[i])
-				}
-				fmt.Printf("; ")
-			} else {
-				fmt.Printf("No VIF extension; ")
-			}
-		}
-
-		if i > frame.DataSize {
-			return fmt.Errorf("premature end of record at VIF.")
-		}
-
-		// re-calculate data length, if of variable length type
-		// 0x0D => Flag for variable data length
-		if record.DIB.DIF&DATA_RECORD_DIF_MASK_DATA == 0x0D {
-			if frame.Data[i] <= 0xBF {
-				i++
-				record.DataSize = int(frame.Data[i])
-			} else if frame.Data[i] >= 0xC0 && frame.Data[i] <= 0xCF {
-				i++
-				record.DataSize = (int(frame.Data[i]) - 0xC0) * 2
-			} else if frame.Data[i] >= 0xD0 && frame.Data[i] <= 0xDF {
-				i++
-				record.DataSize = (int(frame.Data[i]) - 0xD0) * 2
-			} else if frame.Data[i] >= 0xE0 && frame.Data[i] <= 0xEF {
-				i++
-				record.DataSize = int(frame.Data[i]) - 0xE0
-			} else if frame.Data[i] >= 0xF0 && frame.Data[i] <= 0xFA {
-				i++
-				record.DataSize = int(frame.Data[i]) - 0xF0
-			}
-		}
-
-		if DEBUG {
-			fmt.Printf("Record datasize: %d; ", record.DataSize)
-		}
-
-		if i+record.DataSize > frame.DataSize {
-			return fmt.Errorf("premature end of record at data.")
-		}
-
-		// Reserve the Record DataSize for the Data byte slice
-		record.Data = make([]byte, record.DataSize)
-
-		if DEBUG {
-			fmt.Printf("Record data:")
-		}
-
-		// Copy the data over
-		for j := 0; j < record.DataSize; j++ {
-			i++
-			record.Data[j] = frame.Data[i]
-
-			if DEBUG {
-				fmt.Printf(" 0x%.2X", record.Data[j])
-			}
-		}
-
-		if DEBUG {
-			fmt.Println()
-		}
-
-		frame.FrameData.Variable.DataRecords = append(frame.FrameData.Variable.DataRecords, record)
-
-		i++
-	}
-
 	return nil
 }
 
@@ -540,54 +336,15 @@ func (frame *WMBusFrame) DataVariableParse() error {
 //}
 
 func (frame *WMBusFrame) DecodeDataRecords() ([]DecodedDataRecord, error) {
-	//decodedDataRecords := make([]DecodedDataRecord, len(frame.FrameData.Variable.DataRecords))
-	var decodedDataRecords []DecodedDataRecord
-
-	for _, record := range frame.FrameData.Variable.DataRecords {
-		decodedDataRecord := DecodedDataRecord{
-			Function:      record.DecodeRecordFunction(),
-			StorageNumber: record.DecodeStorageNumber(),
-			//Quantity:      "",
-		}
-
-		// Decode the tariff
-		tariff, err := record.DecodeTariff()
-		if err != nil {
-			return nil, err
-		} else {
-			// Decode the device
-			device, _ := record.DecodeDevice()
-			decodedDataRecord.Device = device
-		}
-		decodedDataRecord.Tariff = tariff
-
-		// Decode Unit
-		unit, err := record.DecodeUnit()
-		if err != nil {
-			return nil, err
-		}
-		decodedDataRecord.Unit = unit.Unit
-		decodedDataRecord.Exponent = unit.Exp
-		decodedDataRecord.Type = string(unit.Type)
-
-		value, raw, err := record.DecodeValue()
-		if err != nil {
-			return nil, err
-		}
-		decodedDataRecord.Value = value
-		decodedDataRecord.RawValue = raw
-
-		// Append to the rest
-		decodedDataRecords = append(decodedDataRecords, decodedDataRecord)
-	}
-
-	return decodedDataRecords, nil
+	return decodeDataRecords(frame.FrameData.Variable.DataRecords)
 }
 
 func (frame *WMBusFrame) DecodeFrame() (*DecodedFrame, error) {
 	decodedFrame := &DecodedFrame{
 		ParsedAt: time.Now(),
 		Version:  int(frame.Header.Version),
+		RSSI:     frame.RSSI,
+		LQI:      frame.LQI,
 	}
 
 	//Decode serial number
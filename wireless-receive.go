@@ -0,0 +1,187 @@
+package mbus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Describes the bytes a dongle appends to each received wireless frame, in front of the stop byte
+type ReceiveProfile struct {
+	Name string
+	// Number of bytes appended to each frame
+	TrailerSize int
+	// Convert the trailer to the RSSI in dBm and the link quality indicator, 0 when not reported
+	Decode func(trailer []byte) (rssi int, lqi int)
+}
+
+var (
+	// Nothing is appended to the frames
+	ProfileNone = ReceiveProfile{Name: "none"}
+
+	// Radiocraft RC1180-MBUS with RSSI_MODE enabled, a single byte holding -2 times the RSSI in dBm
+	ProfileRadiocraft = ReceiveProfile{
+		Name:        "radiocraft",
+		TrailerSize: 1,
+		Decode: func(trailer []byte) (int, int) {
+			return -int(trailer[0]) / 2, 0
+		},
+	}
+
+	// Amber AMB8465 with the RSSI enabled, a single byte in the CC1101 encoding
+	ProfileAmber = ReceiveProfile{
+		Name:        "amber",
+		TrailerSize: 1,
+		Decode: func(trailer []byte) (int, int) {
+			return cc1101RSSI(trailer[0]), 0
+		},
+	}
+
+	// Dongles based on the TI CC1101 which append its status bytes, the RSSI followed by the LQI with the CRC_OK bit
+	ProfileCC1101 = ReceiveProfile{
+		Name:        "cc1101",
+		TrailerSize: 2,
+		Decode: func(trailer []byte) (int, int) {
+			return cc1101RSSI(trailer[0]), int(trailer[1] & 0x7F)
+		},
+	}
+)
+
+var receiveProfiles = map[string]ReceiveProfile{
+	ProfileNone.Name:       ProfileNone,
+	ProfileRadiocraft.Name: ProfileRadiocraft,
+	ProfileAmber.Name:      ProfileAmber,
+	ProfileCC1101.Name:     ProfileCC1101,
+}
+
+func ReceiveProfileLookup(name string) (ReceiveProfile, error) {
+	profile, ok := receiveProfiles[strings.ToLower(name)]
+	if !ok {
+		return ReceiveProfile{}, fmt.Errorf("unknown receive profile '%s'", name)
+	}
+
+	return profile, nil
+}
+
+// RSSI register of the CC1101 in two's complement with a resolution of 0.5 dB and an offset of 74 dB
+func cc1101RSSI(raw byte) int {
+	return int(int8(raw))/2 - 74
+}
+
+// Size of a frame including the start and stop byte, 0 when the L-field does not fit the format
+func wirelessFrameSize(length byte, format FrameFormat) int {
+	switch format {
+	case FRAME_FORMAT_A:
+		if size := frameSizeA(length); size > 0 {
+			return size + 2
+		}
+		return 0
+	case FRAME_FORMAT_B:
+		return frameSizeB(length) + 2
+	default:
+		// The L-field excludes the start, the L-field itself and the stop byte
+		return int(length) + 3
+	}
+}
+
+// Decode a wireless frame between a start and stop byte, with the trailer of the profile in front of the stop byte.
+// With link layer CRCs format B is tried first, as it is the smaller of the two for the same L-field.
+func decodeWirelessFrame(data []byte, size int, linkLayerCRC bool, profile ReceiveProfile) (Frame, ParseReturn, error) {
+	if size < 2 {
+		return nil, ParseReturn{Remaining: 2 - size, GotFrame: true}, nil
+	}
+
+	formats := []FrameFormat{FRAME_FORMAT_NONE}
+	if linkLayerCRC {
+		formats = []FrameFormat{FRAME_FORMAT_B, FRAME_FORMAT_A}
+	}
+
+	var reported error
+
+	for _, format := range formats {
+		frameSize := wirelessFrameSize(data[1], format)
+		if frameSize == 0 {
+			continue
+		}
+
+		total := frameSize + profile.TrailerSize
+		if size < total {
+			return nil, ParseReturn{Remaining: total - size, GotFrame: true}, nil
+		}
+
+		frame, err := decodeWirelessFormat(data[:total], format, profile)
+		if err == nil {
+			return frame, ParseReturn{Remaining: 0, GotFrame: true}, nil
+		}
+
+		// Report the corrupted block of the format in which the frame ends with a stop byte
+		if reported == nil || (errors.Is(err, ErrChecksum) && !errors.Is(reported, ErrChecksum)) {
+			reported = err
+		}
+	}
+
+	if reported == nil {
+		reported = newFrameError(&data, size, 1, ErrFraming, fmt.Errorf("invalid L-field 0x%.2X", data[1]))
+	}
+
+	return nil, ParseReturn{Remaining: -3, GotFrame: false}, reported
+}
+
+// Remove the trailer and CRCs of the frame, the result is parsed like a frame with a single CRC at the end
+func decodeWirelessFormat(data []byte, format FrameFormat, profile ReceiveProfile) (*WMBusFrame, error) {
+	size := len(data)
+
+	if data[size-1] != FRAME_STOP {
+		return nil, newFrameError(&data, size, size-1, ErrFraming, fmt.Errorf("no frame stop"))
+	}
+
+	// The frame without the trailer and stop byte
+	end := size - 1 - profile.TrailerSize
+	raw := append(append(make([]byte, 0, end+1), data[:end]...), FRAME_STOP)
+
+	normalized := raw
+	if format != FRAME_FORMAT_NONE {
+		stripped, err := stripFrameCRC(data[1:end], format)
+		if err != nil {
+			// Point into the received bytes, which hold the start byte as well
+			var frameErr *FrameError
+			if errors.As(err, &frameErr) {
+				return nil, newFrameError(&data, size, frameErr.Offset+1, frameErr.Kind, frameErr.Err)
+			}
+
+			return nil, err
+		}
+
+		if normalized, err = normalizeWirelessFrame(stripped); err != nil {
+			return nil, newFrameError(&data, size, 1, ErrUnsupported, err)
+		}
+	}
+
+	frame := NewWirelessMBusFrame()
+	if _, err := ParseWirelessMBusData(frame, &normalized, len(normalized)); err != nil {
+		return nil, err
+	}
+
+	if profile.Decode != nil && profile.TrailerSize > 0 {
+		frame.RSSI, frame.LQI = profile.Decode(data[end : size-1])
+	}
+
+	frame.Raw = raw
+	frame.Format = format
+	return frame, nil
+}
+
+// Wrap a frame without CRCs, which starts with the L-field, into the layout of a frame with a single CRC at the end
+func normalizeWirelessFrame(stripped []byte) ([]byte, error) {
+	if len(stripped)+1 > 0xFF {
+		return nil, fmt.Errorf("frame of %d bytes is too long", len(stripped))
+	}
+
+	// The L-field includes the single CRC at the end
+	normalized := make([]byte, 0, len(stripped)+4)
+	normalized = append(normalized, FRAME_LONG_START, byte(len(stripped)+1))
+	normalized = append(normalized, stripped[1:]...)
+
+	crc := WirelessCRC(normalized[1:])
+	return append(normalized, byte(crc>>8), byte(crc), FRAME_STOP), nil
+}
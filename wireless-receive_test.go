@@ -0,0 +1,91 @@
+package mbus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestReceiveProfile(t *testing.T) {
+	// The trailer is appended in front of the stop byte
+	withTrailer := func(frame []byte, trailer ...byte) []byte {
+		data := append([]byte{}, frame[:len(frame)-1]...)
+		return append(append(data, trailer...), FRAME_STOP)
+	}
+
+	crcFrame, err := EncodeFrameCRC(testLinkFrame(), FRAME_FORMAT_A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crcFrame = append(append([]byte{FRAME_LONG_START}, crcFrame...), FRAME_STOP)
+
+	tests := map[string]struct {
+		profile ReceiveProfile
+		crc     bool
+		data    []byte
+		rssi    int
+		lqi     int
+	}{
+		"radiocraft": {ProfileRadiocraft, false, withTrailer(testFrame, 0x8C), -70, 0},
+		"amber":      {ProfileAmber, false, withTrailer(testFrame, 0xD8), -94, 0},
+		"cc1101":     {ProfileCC1101, false, withTrailer(testFrame, 0x20, 0xAF), -58, 47},
+		"crc":        {ProfileCC1101, true, withTrailer(crcFrame, 0xD8, 0x2F), -94, 47},
+	}
+
+	for name, test := range tests {
+		framer := NewWirelessFramer(&chunkReader{chunks: [][]byte{{0x00}, test.data}})
+		framer.LinkLayerCRC = test.crc
+		framer.Profile = test.profile
+
+		received, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		frame := received.(*WMBusFrame)
+		if frame.RSSI != test.rssi || frame.LQI != test.lqi {
+			t.Fatalf("%s: expected RSSI %d dBm and LQI %d, got: %d dBm and %d", name, test.rssi, test.lqi, frame.RSSI, frame.LQI)
+		}
+
+		// The trailer is not part of the raw frame
+		if !test.crc && !bytes.Equal(frame.Raw, testFrame) {
+			t.Fatalf("%s: unexpected raw frame: % X", name, frame.Raw)
+		}
+
+		key, err := FindAESKeyForSerialNumber("25653")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := frame.DecryptData(key); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if err := frame.DataParse(); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		decodedFrame, err := frame.DecodeFrame()
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if decodedFrame.RSSI != test.rssi || decodedFrame.LQI != test.lqi {
+			t.Fatalf("%s: expected the RSSI and LQI on the decoded frame, got: %d dBm and %d", name, decodedFrame.RSSI, decodedFrame.LQI)
+		}
+	}
+
+	// The LQI is kept in the capture files of the Recorder
+	replayed, err := parseCaptureLine(hex.EncodeToString(testFrame) + " -58 transport=serial parsed=encrypted lqi=47")
+	if err != nil || replayed.RSSI != -58 || replayed.LQI != 47 {
+		t.Fatalf("expected RSSI -58 dBm and LQI 47 from the capture line, got: %+v (%v)", replayed, err)
+	}
+
+	if profile, err := ReceiveProfileLookup("Radiocraft"); err != nil || profile.TrailerSize != 1 {
+		t.Fatalf("expected the radiocraft profile, got: %+v (%v)", profile, err)
+	}
+
+	if _, err := ReceiveProfileLookup("unknown"); err == nil {
+		t.Fatalf("expected an error for an unknown profile")
+	}
+}